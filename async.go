@@ -0,0 +1,145 @@
+package tumble
+
+import (
+	"fmt"
+	"os"
+)
+
+// QueuePolicy decides what an asynchronous Write does when the queue is full.
+type QueuePolicy int
+
+const (
+	QueueBlock      QueuePolicy = iota // Write waits for room in the queue
+	QueueDropNewest                    // Write discards p
+	QueueDropOldest                    // The oldest queued writes are discarded to make room for p
+)
+
+func (me QueuePolicy) String() string {
+	switch me {
+	case QueueBlock:
+		return "block"
+	case QueueDropNewest:
+		return "drop-newest"
+	case QueueDropOldest:
+		return "drop-oldest"
+	}
+	return fmt.Sprintf("QueuePolicy(%d)", int(me))
+}
+
+func (me *Logger) isAsync() bool {
+	return me.AsyncQueueBytes > 0
+}
+
+// writeAsync copies p into the queue, to be written by asyncRun
+func (me *Logger) writeAsync(p []byte) (int, error) {
+	me.asyncMu.Lock()
+	defer me.asyncMu.Unlock()
+
+	if me.asyncClosing {
+		return 0, os.ErrClosed
+	}
+	me.asyncStartOnce.Do(func() {
+		me.asyncWG.Add(1)
+		go me.asyncRun()
+	})
+
+	// A write larger than the whole queue is queued alone
+	size := int64(len(p))
+	for len(me.queue) > 0 && me.queueBytes+size > me.AsyncQueueBytes {
+		switch me.AsyncPolicy {
+		case QueueDropNewest:
+			me.countDroppedLocked(len(p))
+			return len(p), nil
+		case QueueDropOldest:
+			oldest := me.queue[0]
+			me.queue[0] = nil
+			me.queue = me.queue[1:]
+			me.queueBytes -= int64(len(oldest))
+			me.countDroppedLocked(len(oldest))
+		default:
+			me.asyncCond.Wait()
+			if me.asyncClosing {
+				return 0, os.ErrClosed
+			}
+		}
+	}
+
+	me.queue = append(me.queue, append([]byte(nil), p...))
+	me.queueBytes += size
+	me.asyncQueued++
+	me.asyncCond.Broadcast()
+	return len(p), nil
+}
+
+// asyncRun writes out the queue until it is empty and the Logger is closing
+func (me *Logger) asyncRun() {
+	defer me.asyncWG.Done()
+
+	me.asyncMu.Lock()
+	defer me.asyncMu.Unlock()
+	for {
+		for len(me.queue) == 0 && !me.asyncClosing {
+			me.asyncCond.Wait()
+		}
+		if len(me.queue) == 0 {
+			return
+		}
+
+		batch, batchSeq := me.queue, me.asyncQueued
+		me.queue = nil
+		me.queueBytes = 0
+		me.asyncCond.Broadcast()
+		me.asyncMu.Unlock()
+
+		for _, p := range batch {
+			if _, err := me.write(p); err != nil {
+				me.reportError(fmt.Errorf("error in tumble/asyncRun: %w", err))
+			}
+		}
+
+		me.asyncMu.Lock()
+		me.asyncWritten = batchSeq
+		me.asyncCond.Broadcast()
+	}
+}
+
+// drainAsync waits until the writes queued so far have been written (or dropped),
+// but not for those queued meanwhile. Writes are numbered in order as they are
+// queued, and asyncWritten is the number of the last written.
+func (me *Logger) drainAsync() {
+	me.asyncMu.Lock()
+	defer me.asyncMu.Unlock()
+	seq := me.asyncQueued
+	for me.asyncWritten < seq {
+		me.asyncCond.Wait()
+	}
+}
+
+// stopAsync refuses further writes, and waits for the queue to be written
+func (me *Logger) stopAsync() {
+	me.asyncMu.Lock()
+	me.asyncClosing = true
+	me.asyncCond.Broadcast()
+	me.asyncMu.Unlock()
+	me.asyncWG.Wait()
+}
+
+// Dropped returns how many writes, and how many bytes, were discarded because
+// the asynchronous queue was full (see AsyncPolicy) or the disk was (see DiskFullPolicy).
+func (me *Logger) Dropped() (writes, bytes uint64) {
+	me.asyncMu.Lock()
+	defer me.asyncMu.Unlock()
+	return me.droppedWrites, me.droppedBytes
+}
+
+func (me *Logger) countDropped(n int) {
+	me.asyncMu.Lock()
+	defer me.asyncMu.Unlock()
+	me.countDroppedLocked(n)
+}
+
+// countDroppedLocked must be called with me.asyncMu held
+func (me *Logger) countDroppedLocked(n int) {
+	me.droppedWrites++
+	me.droppedBytes += uint64(n)
+}
@@ -4,11 +4,16 @@ import (
 	_ "embed"
 
 	"bufio"
+	"bytes"
+	"context"
 	"flag"
 	"fmt"
 	"io"
 	"os"
+	"os/exec"
 	"os/signal"
+	"os/user"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -22,11 +27,41 @@ var (
 	logfile      string
 	maxLogSize   uint64
 	maxTotalSize uint64
+	rotateEvery  time.Duration
+	codecName    string
+	codecLevel   int
+	codec        tumble.Codec
+	maxAge       time.Duration
+	maxArchives  int
+	minAge       time.Duration
+	reopenCheck  time.Duration
+	minFreeMB    uint64
+	minFreePct   float64
+	diskFull     tumble.DiskFullPolicy
+	archiveDir   string
+	onArchive    string
+	hookRetries  int
+	hookTimeout  time.Duration
+	archiveSink  tumble.ArchiveSink
+	sinkAck      bool
+	eventLog     string
+	nameLayout   string
+	nameSep      string
+	nameSeq      int
+	stampFormat  tumble.TimestampFormat
+	recordDelim  []byte
+	fileMode     os.FileMode
+	dirMode      os.FileMode
+	uid, gid     int
 	isTeeStdout  bool
 	isTeeStderr  bool
 	timeFormat   string
 	formatFn     func(msg []byte, buf []byte) ([]byte, int)
 	isDump       bool
+	isFollow     bool
+	isLock       bool
+	since        time.Time
+	until        time.Time
 	isRotate     bool
 	isVersion    bool
 
@@ -35,16 +70,44 @@ var (
 )
 
 func init_globals() {
-	var dumpfile, rotatefile string
+	var dumpfile, rotatefile, sinceStr, untilStr, recordDelimStr string
+	var fileModeStr, dirModeStr, ownerStr, minFreeStr, diskFullStr, sinkStr string
 
 	flag.StringVar(&logfile /*******/, "logfile" /*********/, "" /*****/, "path to logfile (required)")
 	flag.Uint64Var(&maxLogSize /****/, "max-log-size" /****/, 0 /******/, "max log size before rotation (in MB) (required)")
 	flag.Uint64Var(&maxTotalSize /**/, "max-total-size" /**/, 0 /******/, "max total size before deletion (in MB) (required)")
+	flag.DurationVar(&rotateEvery /**/, "rotate-every" /****/, 0 /******/, "also rotate on wall-clock boundaries of this interval (default: size-based only) (example: 1h, 24h)")
+	flag.StringVar(&codecName /******/, "compress" /********/, "" /*****/, "archive compression codec: gzip, zstd, xz or none (default: gzip)")
+	flag.IntVar(&codecLevel /********/, "compress-level" /**/, 0 /******/, "archive compression level, for gzip (0-9, where 0 is none) or zstd (1-22) (default: codec default)")
+	flag.DurationVar(&maxAge /*******/, "max-age" /*********/, 0 /******/, "delete archives older than this (default: no age limit) (example: 720h)")
+	flag.IntVar(&maxArchives /*******/, "max-archives" /****/, 0 /******/, "keep at most this many archives (default: no count limit)")
+	flag.DurationVar(&minAge /*******/, "min-age" /*********/, 0 /******/, "never delete archives younger than this, even if over a limit (default: no floor)")
+	flag.DurationVar(&reopenCheck /**/, "reopen-check" /****/, 0 /******/, "check this often (on write) whether the logfile was removed or replaced by another program, and reopen it (default: never) (example: 10s)")
+	flag.StringVar(&minFreeStr /*****/, "min-free" /********/, "" /*****/, "keep this much free space on the logfile's filesystem (in MB, or with % of its size), deleting the oldest archives while under it (default: no minimum) (example: 500, 5%)")
+	flag.StringVar(&diskFullStr /****/, "disk-full" /*******/, "" /*****/, "when under -min-free even without archives: write, drop or truncate (the logfile) (default: write)")
+	flag.StringVar(&eventLog /*******/, "event-log" /*******/, "" /*****/, "append rotation/compression/deletion events and errors to this file, or - for stderr (default: errors only, to stderr)")
+	flag.StringVar(&nameLayout /*****/, "name-layout" /*****/, "" /*****/, "name archives with this time layout (in UTC) rather than seconds since epoch (example: '2006-01-02T15-04-05Z')")
+	flag.StringVar(&nameSep /********/, "name-separator" /**/, "" /*****/, "separator between the log name and archive timestamp (default: '-')")
+	flag.IntVar(&nameSeq /***********/, "name-seq" /********/, 0 /******/, "always add a sequence number of this many digits to layout-named archives (default: only when needed)")
+	flag.StringVar(&recordDelimStr /**/, "record-delim" /***/, "" /*****/, "only rotate between records ending in this delimiter, with Go escapes, so that no record is split across files (default: rotate anywhere) (example: '\\n')")
+	flag.StringVar(&fileModeStr /****/, "file-mode" /*******/, "" /*****/, "mode (in octal) for new logfiles and archives (default: 644) (example: 640)")
+	flag.StringVar(&dirModeStr /*****/, "dir-mode" /********/, "" /*****/, "create missing parent directories of the logfile with this mode (in octal) (default: do not create) (example: 750)")
+	flag.StringVar(&ownerStr /*******/, "owner" /***********/, "" /*****/, "chown new logfiles and archives to this user and/or group, by name or id (default: do not chown) (example: app:adm, :adm)")
+	flag.StringVar(&archiveDir /*****/, "archive-dir" /*****/, "" /*****/, "keep compressed archives in this directory, which may be on another filesystem, rather than beside the logfile (also for -dump and -rotate) (default: beside the logfile)")
+	flag.StringVar(&onArchive /******/, "on-archive" /******/, "" /*****/, "run this shell command on each archive once compressed, with {path}, {timestamp} and {size} replaced, and keep the archive until it succeeds (default: none) (example: 'aws s3 cp {path} s3://bucket/')")
+	flag.IntVar(&hookRetries /*******/, "hook-retries" /****/, 0 /******/, "retry a failed -on-archive this many times while logging (with -rotate, it is instead tried again by the next -rotate) (default: 0)")
+	flag.DurationVar(&hookTimeout /**/, "hook-timeout" /****/, 0 /******/, "give up each -on-archive attempt after this long (default: no timeout) (example: 5m)")
+	flag.StringVar(&sinkStr /********/, "sink" /************/, "" /*****/, "also copy each archive, once compressed, to this directory or s3://bucket/prefix/ (with AWS_ENDPOINT_URL, AWS_REGION, AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN from the environment) (default: none)")
+	flag.BoolVar(&sinkAck /**********/, "sink-ack" /********/, false /**/, "only delete archives once -sink has them (default: false)")
 	flag.BoolVar(&isTeeStdout /*****/, "tee-stdout" /******/, false /**/, "tee to stdout (default: false)")
 	flag.BoolVar(&isTeeStderr /*****/, "tee-stderr" /******/, false /**/, "tee to stderr (default: false)")
 	flag.StringVar(&timeFormat /****/, "time-format" /*****/, "" /*****/, "add timestamp with given format (default: no timestamp) (example: '2006-01-02 15:04:05.000')")
 	flag.StringVar(&dumpfile /******/, "dump" /************/, "" /*****/, "dump archives for given filepath and exit (default: do not dump)")
-	flag.StringVar(&rotatefile /****/, "rotate" /**********/, "" /*****/, "rotate given filepath and exit (default: do not rotate-and-exit)\n(IMPORTANT: DO NOT use on a file currently being written to by tumble. Doing so will break logging. Stop the running tumble instance first.)")
+	flag.BoolVar(&isFollow /*********/, "follow" /**********/, false /**/, "with -dump, keep reading as the logfile grows and is rotated, like tail -F (default: false)")
+	flag.StringVar(&sinceStr /*******/, "since" /***********/, "" /*****/, "with -dump, skip history before this RFC 3339 time or duration ago (lines too, with -time-format) (example: 2026-10-16T00:00:00Z, 1h)")
+	flag.StringVar(&untilStr /*******/, "until" /***********/, "" /*****/, "with -dump, skip history after this RFC 3339 time or duration ago (lines too, with -time-format) (example: 2026-10-16T12:00:00Z, 30m)")
+	flag.StringVar(&rotatefile /****/, "rotate" /**********/, "" /*****/, "rotate given filepath and exit (default: do not rotate-and-exit)\n(IMPORTANT: DO NOT use on a file currently being written to by tumble, unless both use -lock. Doing so will break logging. Stop the running tumble instance first.)")
+	flag.BoolVar(&isLock /***********/, "lock" /************/, false /**/, "lock the logfile (via a .lock sidecar file) so that several tumble instances, and -rotate, can share it (default: false)")
 	flag.BoolVar(&isVersion /*******/, "version" /*********/, false /**/, "print version and exit (default: false)")
 	flag.Parse()
 
@@ -54,26 +117,109 @@ func init_globals() {
 	}
 
 	if dumpfile != "" {
-		if logfile != "" || maxLogSize != 0 || maxTotalSize != 0 || rotatefile != "" {
+		if logfile != "" || maxLogSize != 0 || maxTotalSize != 0 || rotateEvery != 0 || maxAge != 0 || maxArchives != 0 || minAge != 0 || rotatefile != "" || isLock || recordDelimStr != "" || reopenCheck != 0 || minFreeStr != "" || diskFullStr != "" || fileModeStr != "" || dirModeStr != "" || ownerStr != "" || onArchive != "" || hookRetries != 0 || hookTimeout != 0 || sinkStr != "" || sinkAck {
 			flag.Usage()
 			os.Exit(1)
 		}
 		isDump = true
 		logfile = dumpfile
 	} else if rotatefile != "" {
-		if logfile != "" || maxLogSize != 0 || maxTotalSize != 0 || dumpfile != "" {
+		if logfile != "" || maxLogSize != 0 || maxTotalSize != 0 || rotateEvery != 0 || dumpfile != "" || isFollow || sinceStr != "" || untilStr != "" || recordDelimStr != "" || reopenCheck != 0 || minFreeStr != "" || diskFullStr != "" {
 			flag.Usage()
 			os.Exit(1)
 		}
 		isRotate = true
 		logfile = rotatefile
 	} else {
-		if logfile == "" || maxLogSize == 0 || maxTotalSize == 0 || dumpfile != "" || rotatefile != "" {
+		if logfile == "" || maxLogSize == 0 || maxTotalSize == 0 || dumpfile != "" || rotatefile != "" || isFollow || sinceStr != "" || untilStr != "" {
 			flag.Usage()
 			os.Exit(1)
 		}
 	}
 
+	isCodecLevel := false
+	flag.Visit(func(f *flag.Flag) { isCodecLevel = isCodecLevel || f.Name == "compress-level" })
+	if codecName != "" || isCodecLevel {
+		if codecName == "" {
+			codecName = "gzip"
+		}
+		if !isCodecLevel {
+			codecLevel = tumble.DefaultLevel
+		}
+		var err error
+		if codec, err = tumble.CodecByName(codecName, codecLevel); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			flag.Usage()
+			os.Exit(1)
+		}
+	}
+
+	if sinceStr != "" {
+		var err error
+		if since, err = parseTimeFlag(sinceStr); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			flag.Usage()
+			os.Exit(1)
+		}
+	}
+	if untilStr != "" {
+		var err error
+		if until, err = parseTimeFlag(untilStr); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			flag.Usage()
+			os.Exit(1)
+		}
+	}
+
+	if recordDelimStr != "" {
+		s, err := strconv.Unquote(`"` + recordDelimStr + `"`)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid record delimiter %q: %v\n", recordDelimStr, err)
+			flag.Usage()
+			os.Exit(1)
+		}
+		recordDelim = []byte(s)
+	}
+
+	var err error
+	if fileMode, err = parseMode(fileModeStr); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		flag.Usage()
+		os.Exit(1)
+	}
+	if dirMode, err = parseMode(dirModeStr); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		flag.Usage()
+		os.Exit(1)
+	}
+	if uid, gid, err = parseOwner(ownerStr); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if minFreeMB, minFreePct, err = parseMinFree(minFreeStr); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		flag.Usage()
+		os.Exit(1)
+	}
+	if diskFull, err = parseDiskFull(diskFullStr); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		flag.Usage()
+		os.Exit(1)
+	}
+	if archiveSink, err = parseSink(sinkStr); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	stampFormat = tumble.TimestampFormat{
+		Separator: nameSep,
+		Layout:    nameLayout,
+		SeqDigits: nameSeq,
+	}
+
 	if timeFormat != "" {
 		formatFn = func(msg []byte, buf []byte) ([]byte, int) {
 			now := time.Now().UTC().Format(timeFormat)
@@ -85,6 +231,121 @@ func init_globals() {
 	}
 }
 
+// parseTimeFlag parses an RFC 3339 time, or a duration before now
+func parseTimeFlag(s string) (time.Time, error) {
+	if ts, err := time.Parse(time.RFC3339, s); err == nil {
+		return ts, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q: expected an RFC 3339 time or a duration", s)
+	}
+	return time.Now().Add(-d), nil
+}
+
+// parseMode parses an octal file mode. The empty string is 0 (the default).
+func parseMode(s string) (os.FileMode, error) {
+	if s == "" {
+		return 0, nil
+	}
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || os.FileMode(mode)&^os.ModePerm != 0 {
+		return 0, fmt.Errorf("invalid mode %q: expected octal permission bits, e.g. 640", s)
+	}
+	return os.FileMode(mode), nil
+}
+
+// parseOwner parses "user", "user:group" or ":group", each by name or id.
+// Whichever is not given is -1 (unchanged).
+func parseOwner(s string) (int, int, error) {
+	uid, gid := -1, -1
+	if s == "" {
+		return uid, gid, nil
+	}
+	userStr, groupStr, _ := strings.Cut(s, ":")
+	if userStr != "" {
+		if u, err := user.Lookup(userStr); err == nil {
+			userStr = u.Uid
+		}
+		id, err := strconv.Atoi(userStr)
+		if err != nil || id < 0 {
+			return 0, 0, fmt.Errorf("invalid owner %q: unknown user", s)
+		}
+		uid = id
+	}
+	if groupStr != "" {
+		if g, err := user.LookupGroup(groupStr); err == nil {
+			groupStr = g.Gid
+		}
+		id, err := strconv.Atoi(groupStr)
+		if err != nil || id < 0 {
+			return 0, 0, fmt.Errorf("invalid owner %q: unknown group", s)
+		}
+		gid = id
+	}
+	return uid, gid, nil
+}
+
+// parseMinFree parses a size in MB, or a percentage (with %)
+func parseMinFree(s string) (uint64, float64, error) {
+	if s == "" {
+		return 0, 0, nil
+	}
+	if pctStr, ok := strings.CutSuffix(s, "%"); ok {
+		pct, err := strconv.ParseFloat(pctStr, 64)
+		if err != nil || pct < 0 || pct >= 100 {
+			return 0, 0, fmt.Errorf("invalid free space %q: expected a percentage under 100", s)
+		}
+		return 0, pct, nil
+	}
+	mb, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid free space %q: expected a size in MB, or a percentage", s)
+	}
+	return mb, 0, nil
+}
+
+func parseDiskFull(s string) (tumble.DiskFullPolicy, error) {
+	for _, policy := range []tumble.DiskFullPolicy{tumble.DiskFullWrite, tumble.DiskFullDrop, tumble.DiskFullTruncate} {
+		if s == "" || s == policy.String() {
+			return policy, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid disk-full policy %q: expected write, drop or truncate", s)
+}
+
+// parseSink parses a directory, or "s3://bucket/prefix/" with the rest of its config from the environment
+func parseSink(s string) (tumble.ArchiveSink, error) {
+	if s == "" {
+		return nil, nil
+	}
+	rest, ok := strings.CutPrefix(s, "s3://")
+	if !ok {
+		return tumble.LocalSink{Dir: s}, nil
+	}
+	bucket, prefix, _ := strings.Cut(rest, "/")
+	if bucket == "" {
+		return nil, fmt.Errorf("invalid sink %q: expected s3://bucket/prefix/", s)
+	}
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = "us-east-1"
+	}
+	endpoint := os.Getenv("AWS_ENDPOINT_URL")
+	if endpoint == "" {
+		endpoint = "https://s3." + region + ".amazonaws.com"
+	}
+	return tumble.S3Sink{
+		Endpoint:        endpoint,
+		Region:          region,
+		Bucket:          bucket,
+		Prefix:          prefix,
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}, nil
+}
+
 func runLogBinaryMode(logger *tumble.Logger) error {
 	writers := []io.Writer{logger}
 	if isTeeStdout {
@@ -120,13 +381,88 @@ func runLogTextMode(logger *tumble.Logger) error {
 	return scanner.Err()
 }
 
+// openEventLog returns an OnEvent which writes to the -event-log, and a function to
+// close it once the Logger is closed. Without an -event-log, there is instead an
+// OnError which prints errors to stderr.
+func openEventLog() (func(event tumble.Event), func(err error), func() error, error) {
+	if eventLog == "" {
+		onError := func(err error) {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		return nil, onError, func() error { return nil }, nil
+	}
+	out, closeFn := os.Stderr, func() error { return nil }
+	if eventLog != "-" {
+		f, err := os.OpenFile(eventLog, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("can't open event log: %w", err)
+		}
+		out, closeFn = f, f.Close
+	}
+	onEvent := func(event tumble.Event) {
+		fmt.Fprintln(out, event)
+	}
+	return onEvent, nil, closeFn, nil
+}
+
+// archiveHook runs command through sh for each archive, with {path}, {timestamp} and {size} replaced
+func archiveHook(command string) func(ctx context.Context, archive tumble.Archive) error {
+	if command == "" {
+		return nil
+	}
+	return func(ctx context.Context, archive tumble.Archive) error {
+		replacer := strings.NewReplacer(
+			"{path}", shellQuote(archive.Path),
+			"{timestamp}", archive.Timestamp.UTC().Format(time.RFC3339Nano),
+			"{size}", strconv.FormatInt(archive.Size, 10),
+		)
+		out, err := exec.CommandContext(ctx, "sh", "-c", replacer.Replace(command)).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("-on-archive command failed: %w: %s", err, bytes.TrimSpace(out))
+		}
+		return nil
+	}
+}
+
+// shellQuote quotes s as a single word for sh
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
 func runLog() error {
-	logger := tumble.NewLogger(
-		/* Filepath:       */ logfile,
-		/* MaxLogSizeMB:   */ maxLogSize,
-		/* MaxTotalSizeMB: */ maxTotalSize,
-		/* FormatFn:       */ formatFn,
+	onEvent, onError, closeEventLog, err := openEventLog()
+	if err != nil {
+		return err
+	}
+	defer closeEventLog()
+
+	logger, err := tumble.NewLoggerWithOptions(logfile,
+		tumble.WithMaxLogSizeMB(maxLogSize),
+		tumble.WithMaxTotalSizeMB(maxTotalSize),
+		tumble.WithFormatFn(formatFn),
+		tumble.WithRotateInterval(rotateEvery),
+		tumble.WithCodec(codec),
+		tumble.WithMaxArchiveAge(maxAge),
+		tumble.WithMaxArchives(maxArchives),
+		tumble.WithMinArchiveAge(minAge),
+		tumble.WithFilestamper(stampFormat),
+		tumble.WithFileLock(isLock),
+		tumble.WithRecordDelimiter(recordDelim),
+		tumble.WithFileMode(fileMode),
+		tumble.WithDirMode(dirMode),
+		tumble.WithOwner(uid, gid),
+		tumble.WithReopenCheckInterval(reopenCheck),
+		tumble.WithMinFree(minFreeMB, minFreePct),
+		tumble.WithDiskFullPolicy(diskFull),
+		tumble.WithArchiveDir(archiveDir),
+		tumble.WithOnArchive(archiveHook(onArchive), hookRetries, hookTimeout),
+		tumble.WithArchiveSink(archiveSink, sinkAck),
+		tumble.WithOnEvent(onEvent),
+		tumble.WithOnError(onError),
 	)
+	if err != nil {
+		return err
+	}
 	defer logger.Close()
 
 	var runFn func(logger *tumble.Logger) error
@@ -136,17 +472,26 @@ func runLog() error {
 		runFn = runLogBinaryMode
 	}
 
-	// Schedule cleanup on interrupt
+	// Schedule cleanup on interrupt. SIGUSR1 reopens the logfile (after an external
+	// tool has moved it away). SIGHUP and SIGUSR2 rotate it. None of these exit, so
+	// stdin continues to be consumed.
 	sigCh := make(chan os.Signal, 2)
-	signal.Notify(sigCh, os.Interrupt, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGUSR1, syscall.SIGUSR2)
 	go func() {
-		sig := <-sigCh
-		switch sig {
-		case os.Interrupt, syscall.SIGINT, syscall.SIGTERM:
-			logger.StopMill()
-		case syscall.SIGHUP:
-			logger.RotateClose()
-			os.Exit(0)
+		for sig := range sigCh {
+			switch sig {
+			case os.Interrupt, syscall.SIGINT, syscall.SIGTERM:
+				logger.StopMill()
+				return
+			case syscall.SIGUSR1:
+				if err := logger.Reopen(); err != nil {
+					fmt.Fprintln(os.Stderr, "error in tumble/reopen:", err)
+				}
+			case syscall.SIGHUP, syscall.SIGUSR2:
+				if err := logger.Rotate(); err != nil {
+					fmt.Fprintln(os.Stderr, "error in tumble/rotate:", err)
+				}
+			}
 		}
 	}()
 
@@ -157,6 +502,12 @@ func runDump() error {
 	muster := tumble.NewMuster(
 		/* Filepath: */ logfile,
 	)
+	muster.Filestamper = stampFormat
+	muster.ArchiveDir = archiveDir
+	muster.Follow = isFollow
+	muster.Since = since
+	muster.Until = until
+	muster.LineTimeFormat = timeFormat
 	defer muster.Close()
 
 	writers := []io.Writer{os.Stdout}
@@ -168,12 +519,33 @@ func runDump() error {
 }
 
 func runRotate() error {
-	logger := tumble.NewLogger(
-		/* Filepath:       */ logfile,
-		/* MaxLogSizeMB:   */ 100000000000,
-		/* MaxTotalSizeMB: */ 999999999999,
-		/* FormatFn:       */ nil,
+	onEvent, onError, closeEventLog, err := openEventLog()
+	if err != nil {
+		return err
+	}
+	defer closeEventLog()
+
+	logger, err := tumble.NewLoggerWithOptions(logfile,
+		tumble.WithMaxLogSizeMB(100000000000),
+		tumble.WithMaxTotalSizeMB(999999999999),
+		tumble.WithCodec(codec),
+		tumble.WithMaxArchiveAge(maxAge),
+		tumble.WithMaxArchives(maxArchives),
+		tumble.WithMinArchiveAge(minAge),
+		tumble.WithFilestamper(stampFormat),
+		tumble.WithFileLock(isLock),
+		tumble.WithFileMode(fileMode),
+		tumble.WithDirMode(dirMode),
+		tumble.WithOwner(uid, gid),
+		tumble.WithArchiveDir(archiveDir),
+		tumble.WithOnArchive(archiveHook(onArchive), hookRetries, hookTimeout),
+		tumble.WithArchiveSink(archiveSink, sinkAck),
+		tumble.WithOnEvent(onEvent),
+		tumble.WithOnError(onError),
 	)
+	if err != nil {
+		return err
+	}
 	return logger.RotateClose()
 }
 
@@ -12,6 +12,7 @@ import (
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"syscall"
 	"testing"
@@ -731,3 +732,688 @@ func TestIntegrationDumpBinaryMode(t *testing.T) {
 
 	teardown()
 }
+
+func TestIntegrationRotateCompressZstd(t *testing.T) {
+	setup()
+
+	data := "this is a\nzstd compressed\narchive\n"
+	if err := ioutil.WriteFile("tmp/foo.log", []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(
+		"./tumble",
+		"--rotate", "tmp/foo.log",
+		"--compress", "zstd",
+		"--compress-level", "19",
+	)
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := os.ReadDir("tmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("Expected 2 files but instead found %d", len(files))
+	}
+	if !strings.HasSuffix(files[0].Name(), ".log.zst") {
+		t.Fatalf("Expected a zstd archive but instead found %s", files[0].Name())
+	}
+
+	var stdout bytes.Buffer
+	cmd = exec.Command(
+		"./tumble",
+		"--dump", "tmp/foo.log",
+	)
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != data {
+		t.Fatalf("%q != %q", stdout.String(), data)
+	}
+
+	teardown()
+}
+
+func TestIntegrationRotateCompressLevelXz(t *testing.T) {
+	setup()
+
+	if err := ioutil.WriteFile("tmp/foo.log", []byte("hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(
+		"./tumble",
+		"--rotate", "tmp/foo.log",
+		"--compress", "xz",
+		"--compress-level", "5",
+	)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err == nil {
+		t.Fatal("expected -compress-level to be rejected for xz")
+	}
+	if !strings.Contains(stderr.String(), "no compression levels") {
+		t.Fatalf("expected a codec error but got %q", stderr.String())
+	}
+
+	teardown()
+}
+
+func TestIntegrationRotateCompressLevelGzip(t *testing.T) {
+	setup()
+
+	if err := ioutil.WriteFile("tmp/foo.log", []byte("hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(
+		"./tumble",
+		"--rotate", "tmp/foo.log",
+		"--compress-level", "50",
+	)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err == nil {
+		t.Fatal("expected -compress-level 50 to be rejected for gzip")
+	}
+	if !strings.Contains(stderr.String(), "must be from") {
+		t.Fatalf("expected a codec error but got %q", stderr.String())
+	}
+
+	teardown()
+}
+
+func TestIntegrationDumpFollow(t *testing.T) {
+	setup()
+
+	if err := ioutil.WriteFile("tmp/foo.log", []byte("line 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(
+		"./tumble",
+		"--dump", "tmp/foo.log",
+		"--follow",
+	)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Wait()
+	defer cmd.Process.Kill()
+
+	linesCh := make(chan string)
+	go func() {
+		stdoutScanner := bufio.NewScanner(stdout)
+		for stdoutScanner.Scan() {
+			linesCh <- stdoutScanner.Text()
+		}
+		close(linesCh)
+	}()
+	expectLine := func(expected string) {
+		select {
+		case got := <-linesCh:
+			if got != expected {
+				t.Fatalf("expected '%s' but got '%s'", expected, got)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for '%s'", expected)
+		}
+	}
+
+	expectLine("line 1")
+
+	f, err := os.OpenFile("tmp/foo.log", os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("line 2\n")); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	expectLine("line 2")
+
+	if err := exec.Command("./tumble", "--rotate", "tmp/foo.log").Run(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile("tmp/foo.log", []byte("line 3\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	expectLine("line 3")
+
+	teardown()
+}
+
+func TestIntegrationDumpSinceUntil(t *testing.T) {
+	setup()
+	createDumpTextData()
+
+	archiveTime := func(i int) time.Time { return time.Unix(int64(1500000055+100*i), 0).UTC() }
+
+	var stdout bytes.Buffer
+	cmd := exec.Command(
+		"./tumble",
+		"--dump", "tmp/foo.log",
+		"--since", archiveTime(1990).Add(-time.Second).Format(time.RFC3339),
+		"--until", archiveTime(1995).Add(time.Second).Format(time.RFC3339),
+	)
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Archive 1996 holds what was written after archive 1995, so it's the last needed
+	idx := 1990
+	stdoutScanner := bufio.NewScanner(strings.NewReader(stdout.String()))
+	for stdoutScanner.Scan() {
+		expected := fmt.Sprintf("This is file number %d", idx)
+		got := stdoutScanner.Text()
+		if got != expected {
+			t.Fatalf("expected '%s' but got '%s'", expected, got)
+		}
+		idx += 1
+	}
+	if err := stdoutScanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if idx != 1996+1 {
+		t.Fatalf("expected idx=1997 but got idx=%d", idx)
+	}
+
+	teardown()
+}
+
+func TestIntegrationRotateWithLock(t *testing.T) {
+	setup()
+
+	cmd := exec.Command(
+		"./tumble",
+		"--logfile", "tmp/foo.log",
+		"--max-log-size", "2",
+		"--max-total-size", "10",
+		"--lock",
+	)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	writeLines := func(from, to int) {
+		for i := from; i < to; i++ {
+			if _, err := stdin.Write([]byte(fmt.Sprintf("This is line number %d\n", i))); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// Allow the writes to land
+		time.Sleep(200 * time.Millisecond)
+	}
+
+	// Rotate underneath the running writer, which carries on in the new logfile
+	writeLines(0, 100)
+	if err := exec.Command("./tumble", "--rotate", "tmp/foo.log", "--lock").Run(); err != nil {
+		t.Fatal(err)
+	}
+	writeLines(100, 200)
+
+	stdin.Close()
+	if err := cmd.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := os.ReadDir("tmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 3 {
+		t.Fatalf("Expected 3 files but instead found %d", len(files))
+	}
+	fi, err := os.Stat("tmp/foo.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() != int64(len("This is line number 100\n")*100) {
+		t.Fatalf("Expected foo.log to hold only the lines after rotation but found size %d", fi.Size())
+	}
+
+	var stdout bytes.Buffer
+	cmd = exec.Command(
+		"./tumble",
+		"--dump", "tmp/foo.log",
+	)
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	idx := 0
+	stdoutScanner := bufio.NewScanner(strings.NewReader(stdout.String()))
+	for stdoutScanner.Scan() {
+		expected := fmt.Sprintf("This is line number %d", idx)
+		got := stdoutScanner.Text()
+		if got != expected {
+			t.Fatalf("expected '%s' but got '%s'", expected, got)
+		}
+		idx += 1
+	}
+	if idx != 200 {
+		t.Fatalf("expected idx=200 but got idx=%d", idx)
+	}
+
+	teardown()
+}
+
+func TestIntegrationLogSignals(t *testing.T) {
+	setup()
+
+	cmd := exec.Command(
+		"./tumble",
+		"--logfile", "tmp/foo.log",
+		"--max-log-size", "2",
+		"--max-total-size", "10",
+	)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	writeLines := func(from, to int) {
+		for i := from; i < to; i++ {
+			if _, err := stdin.Write([]byte(fmt.Sprintf("This is line number %d\n", i))); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// Allow the writes to land
+		time.Sleep(200 * time.Millisecond)
+	}
+	sendSignal := func(sig os.Signal) {
+		if err := cmd.Process.Signal(sig); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+
+	// SIGUSR1 reopens after the logfile is moved away (as by logrotate)
+	writeLines(0, 50)
+	if err := os.Rename("tmp/foo.log", "tmp/foo.log.1"); err != nil {
+		t.Fatal(err)
+	}
+	sendSignal(syscall.SIGUSR1)
+	writeLines(50, 100)
+
+	// SIGUSR2 and SIGHUP rotate without exiting
+	sendSignal(syscall.SIGUSR2)
+	writeLines(100, 150)
+	sendSignal(syscall.SIGHUP)
+	writeLines(150, 200)
+
+	stdin.Close()
+	if err := cmd.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := os.ReadDir("tmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 4 {
+		t.Fatalf("Expected 4 files but instead found %d", len(files))
+	}
+
+	expectLines := func(data []byte, from, to int) {
+		idx := from
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			expected := fmt.Sprintf("This is line number %d", idx)
+			if got := scanner.Text(); got != expected {
+				t.Fatalf("expected '%s' but got '%s'", expected, got)
+			}
+			idx += 1
+		}
+		if idx != to {
+			t.Fatalf("expected idx=%d but got idx=%d", to, idx)
+		}
+	}
+
+	moved, err := ioutil.ReadFile("tmp/foo.log.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectLines(moved, 0, 50)
+
+	var stdout bytes.Buffer
+	cmd = exec.Command(
+		"./tumble",
+		"--dump", "tmp/foo.log",
+	)
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	expectLines(stdout.Bytes(), 50, 200)
+
+	teardown()
+}
+
+func TestIntegrationLogRecordDelim(t *testing.T) {
+	setup()
+
+	// Lines of varying length, copied in binary mode in chunks which ignore them
+	var data []byte
+	for i := 0; len(data) < 3*1024*1024; i++ {
+		data = append(data, fmt.Sprintf("line %d %s\n", i, strings.Repeat("x", i%100))...)
+	}
+
+	cmd := exec.Command(
+		"./tumble",
+		"--logfile", "tmp/foo.log",
+		"--max-log-size", "1",
+		"--max-total-size", "100",
+		"--record-delim", `\n`,
+	)
+	cmd.Stdin = bytes.NewReader(data)
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := ioutil.ReadDir("tmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) < 3 {
+		t.Fatalf("expected at least 3 files but got %d", len(files))
+	}
+	total := 0
+	for _, f := range files {
+		content, err := ioutil.ReadFile("tmp/" + f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.HasSuffix(f.Name(), ".gz") {
+			gz, err := gzip.NewReader(bytes.NewReader(content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if content, err = ioutil.ReadAll(gz); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if !bytes.HasSuffix(content, []byte("\n")) {
+			t.Fatalf("%s ends mid-line", f.Name())
+		}
+		total += len(content)
+	}
+	if total != len(data) {
+		t.Fatalf("expected %d bytes but got %d", len(data), total)
+	}
+
+	teardown()
+}
+
+func TestIntegrationLogInvalidSizes(t *testing.T) {
+	setup()
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(
+		"./tumble",
+		"--logfile", "tmp/foo.log",
+		"--max-log-size", "10",
+		"--max-total-size", "5",
+	)
+	cmd.Stdin = strings.NewReader("hello\n")
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(stderr.String(), "must be at least") {
+		t.Fatalf("expected a config error but got %q", stderr.String())
+	}
+	if _, err := os.Stat("tmp/foo.log"); !os.IsNotExist(err) {
+		t.Fatalf("expected no logfile but got %v", err)
+	}
+
+	teardown()
+}
+
+func TestIntegrationLogFileMode(t *testing.T) {
+	setup()
+
+	cmd := exec.Command(
+		"./tumble",
+		"--logfile", "tmp/a/b/foo.log",
+		"--max-log-size", "10",
+		"--max-total-size", "20",
+		"--file-mode", "600",
+		"--dir-mode", "750",
+		"--owner", fmt.Sprintf(":%d", os.Getgid()),
+	)
+	cmd.Stdin = strings.NewReader("hello\n")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	for path, mode := range map[string]os.FileMode{"tmp/a": 0750, "tmp/a/b": 0750, "tmp/a/b/foo.log": 0600} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != mode {
+			t.Fatalf("expected %s to have mode %s but got %s", path, mode, info.Mode().Perm())
+		}
+	}
+
+	teardown()
+}
+
+func TestIntegrationLogDiskFull(t *testing.T) {
+	setup()
+
+	// No real filesystem is this empty, so writes are dropped
+	cmd := exec.Command(
+		"./tumble",
+		"--logfile", "tmp/foo.log",
+		"--max-log-size", "10",
+		"--max-total-size", "20",
+		"--min-free", "99.99%",
+		"--disk-full", "drop",
+	)
+	cmd.Stdin = strings.NewReader("hello\n")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	fileContent, err := ioutil.ReadFile("tmp/foo.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fileContent) != 0 {
+		t.Fatalf("expected an empty logfile but got %q", fileContent)
+	}
+
+	teardown()
+}
+
+func TestIntegrationRotateArchiveDir(t *testing.T) {
+	setup()
+
+	data := "this is an\narchive kept\nelsewhere\n"
+	if err := ioutil.WriteFile("tmp/foo.log", []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(
+		"./tumble",
+		"--rotate", "tmp/foo.log",
+		"--archive-dir", "tmp/archives",
+	)
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := os.ReadDir("tmp/archives")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || !strings.HasSuffix(files[0].Name(), ".log.gz") {
+		t.Fatalf("Expected one archive in tmp/archives but instead found %v", files)
+	}
+
+	var stdout bytes.Buffer
+	cmd = exec.Command(
+		"./tumble",
+		"--dump", "tmp/foo.log",
+		"--archive-dir", "tmp/archives",
+	)
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != data {
+		t.Fatalf("%q != %q", stdout.String(), data)
+	}
+
+	teardown()
+}
+
+func TestIntegrationRotateOnArchive(t *testing.T) {
+	setup()
+
+	if err := os.Mkdir("tmp/shipped", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// The hook fails the first time, leaving the archive pending for the next -rotate
+	rotate := func(data string) {
+		if err := ioutil.WriteFile("tmp/foo.log", []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		cmd := exec.Command(
+			"./tumble",
+			"--rotate", "tmp/foo.log",
+			"--on-archive", "test -e tmp/failed && cp {path} tmp/shipped/ || { touch tmp/failed; exit 1; }",
+			"--hook-retries", "1",
+			"--hook-timeout", "10s",
+		)
+		if err := cmd.Run(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rotate("this is an\narchive to ship\n")
+	files, err := filepath.Glob("tmp/foo-*.log.gz*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || !strings.HasSuffix(files[1], ".pending") {
+		t.Fatalf("Expected the archive and its pending marker, but instead found %v", files)
+	}
+
+	time.Sleep(1 * time.Second)
+	rotate("this is another\narchive to ship\n")
+	files, err = filepath.Glob("tmp/foo-*.log.gz*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("Expected only the archives, without pending markers, but instead found %v", files)
+	}
+	for _, file := range files {
+		archive, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		shipped, err := ioutil.ReadFile(filepath.Join("tmp/shipped", filepath.Base(file)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(archive, shipped) {
+			t.Fatal("Expected the hook to copy the archive")
+		}
+	}
+
+	teardown()
+}
+
+func TestIntegrationRotateSink(t *testing.T) {
+	setup()
+
+	data := "this is an\narchive to copy\n"
+	if err := ioutil.WriteFile("tmp/foo.log", []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir("tmp/cold", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(
+		"./tumble",
+		"--rotate", "tmp/foo.log",
+		"--sink", "tmp/cold",
+		"--sink-ack",
+	)
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := filepath.Glob("tmp/foo-*.log.gz*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("Expected only the archive, without a pending marker, but instead found %v", files)
+	}
+	archive, err := ioutil.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	copied, err := ioutil.ReadFile(filepath.Join("tmp/cold", filepath.Base(files[0])))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(archive, copied) {
+		t.Fatal("Expected the sink to copy the archive")
+	}
+
+	teardown()
+}
+
+func TestIntegrationRotateMaxArchives(t *testing.T) {
+	setup()
+
+	for i := 0; i < 3; i++ {
+		if err := ioutil.WriteFile("tmp/foo.log", []byte(fmt.Sprintf("file %d\n", i)), 0644); err != nil {
+			t.Fatal(err)
+		}
+		cmd := exec.Command(
+			"./tumble",
+			"--rotate", "tmp/foo.log",
+			"--max-archives", "2",
+		)
+		if err := cmd.Run(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := filepath.Glob("tmp/foo-*.log.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("Expected 2 archives but instead found %v", files)
+	}
+
+	teardown()
+}
@@ -0,0 +1,163 @@
+package tumble
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// Codec compresses rotated logfiles into archives and decompresses them again.
+//
+// The suffix is appended to the archive filename (e.g. "foo-1699999999.log.gz")
+// and identifies the codec when archives are read back, so it must be unique.
+type Codec interface {
+	Suffix() string
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+var _ Codec = GzipCodec{} // Implement Codec
+var _ Codec = ZstdCodec{} // Implement Codec
+var _ Codec = XzCodec{}   // Implement Codec
+var _ Codec = NoneCodec{} // Implement Codec
+
+// The default codec is used when Logger.Codec is nil.
+var defaultCodec Codec = GzipCodec{}
+
+// These are all the codecs whose archives are recognised when reading.
+var builtinCodecs = []Codec{defaultCodec, ZstdCodec{}, XzCodec{}, NoneCodec{}}
+
+// GzipCodec produces ".gz" archives. Level is as for gzip.NewWriterLevel, other
+// than that a zero Level means the gzip default. Set NoCompression instead for
+// gzip.NoCompression.
+type GzipCodec struct {
+	Level         int
+	NoCompression bool
+}
+
+func (me GzipCodec) Suffix() string {
+	return compressSuffix
+}
+
+func (me GzipCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	switch {
+	case me.NoCompression:
+		return gzip.NewWriterLevel(w, gzip.NoCompression)
+	case me.Level == 0:
+		return gzip.NewWriterLevel(w, gzip.DefaultCompression)
+	}
+	return gzip.NewWriterLevel(w, me.Level)
+}
+
+func (me GzipCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+// ZstdCodec produces ".zst" archives. Level follows the zstd command-line
+// levels (1-22). A zero Level means the zstd default.
+type ZstdCodec struct {
+	Level int
+}
+
+func (me ZstdCodec) Suffix() string {
+	return ".zst"
+}
+
+func (me ZstdCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	if me.Level == 0 {
+		return zstd.NewWriter(w)
+	}
+	return zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(me.Level)))
+}
+
+func (me ZstdCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	dec, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return dec.IOReadCloser(), nil
+}
+
+// XzCodec produces ".xz" archives.
+type XzCodec struct{}
+
+func (me XzCodec) Suffix() string {
+	return ".xz"
+}
+
+func (me XzCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return xz.NewWriter(w)
+}
+
+func (me XzCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	xzr, err := xz.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(xzr), nil
+}
+
+// NoneCodec stores archives uncompressed with a ".raw" suffix.
+// This is useful when the logged payload is already compressed.
+//
+// (An uncompressed archive without a suffix is still waiting to be processed.)
+type NoneCodec struct{}
+
+func (me NoneCodec) Suffix() string {
+	return ".raw"
+}
+
+func (me NoneCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return nopWriteCloser{w}, nil
+}
+
+func (me NoneCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(r), nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// CodecByName returns the built-in codec with the given name ("gzip", "zstd",
+// "xz" or "none") and compression level. A level of DefaultLevel chooses the
+// codec's default. The "xz" and "none" codecs have no levels.
+func CodecByName(name string, level int) (Codec, error) {
+	switch name {
+	case "gzip", "gz":
+		if level == gzip.NoCompression {
+			return GzipCodec{NoCompression: true}, nil
+		}
+		if level == DefaultLevel {
+			return GzipCodec{}, nil
+		}
+		if level < gzip.HuffmanOnly || level > gzip.BestCompression {
+			return nil, fmt.Errorf("gzip compression level %d must be from %d to %d", level, gzip.HuffmanOnly, gzip.BestCompression)
+		}
+		return GzipCodec{Level: level}, nil
+	case "zstd", "zst":
+		if level == DefaultLevel {
+			return ZstdCodec{}, nil
+		}
+		return ZstdCodec{Level: level}, nil
+	case "xz", "none", "raw":
+		if level != DefaultLevel {
+			return nil, fmt.Errorf("codec %s has no compression levels", name)
+		}
+		if name == "xz" {
+			return XzCodec{}, nil
+		}
+		return NoneCodec{}, nil
+	}
+	return nil, fmt.Errorf("unknown codec: %s", name)
+}
+
+// DefaultLevel may be passed to CodecByName for the codec's default compression level.
+const DefaultLevel = -1
@@ -0,0 +1,164 @@
+package tumble
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// spaceCheckInterval is how often a Write checks free space (see guardSpace)
+var spaceCheckInterval = time.Second
+
+// DiskFullPolicy decides what a Write does when free space on the logfile's
+// filesystem stays under MinFreeMB or MinFreePercent, even after deleting archives.
+type DiskFullPolicy int
+
+const (
+	DiskFullWrite    DiskFullPolicy = iota // Write anyway (which fails once the disk is full)
+	DiskFullDrop                           // Discard the write, counted by Dropped
+	DiskFullTruncate                       // Truncate the logfile on each check, and then write
+)
+
+func (me DiskFullPolicy) String() string {
+	switch me {
+	case DiskFullWrite:
+		return "write"
+	case DiskFullDrop:
+		return "drop"
+	case DiskFullTruncate:
+		return "truncate"
+	}
+	return fmt.Sprintf("DiskFullPolicy(%d)", int(me))
+}
+
+// diskSpace returns the free space (available to us) and the total size of the filesystem holding dir
+func diskSpace(dir string) (avail, total uint64, err error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return 0, 0, fmt.Errorf("can't get free space: %w", err)
+	}
+	return st.Bavail * uint64(st.Bsize), st.Blocks * uint64(st.Bsize), nil
+}
+
+func (me *Logger) isSpaceGuarded() bool {
+	return me.MinFreeMB > 0 || me.MinFreePercent > 0
+}
+
+// isLowSpace reports whether free space on dir's filesystem is under MinFreeMB or MinFreePercent
+func (me *Logger) isLowSpace(dir string) (bool, error) {
+	avail, total, err := diskSpaceFn(dir)
+	if err != nil {
+		return false, err
+	}
+	if avail < me.MinFreeMB*MB {
+		return true, nil
+	}
+	return float64(avail) < me.MinFreePercent/100*float64(total), nil
+}
+
+// reclaimSpace deletes the oldest archives while free space (where they are kept) is low,
+// other than those younger than MinArchiveAge or held pending (see isHeld). It reports whether
+// free space is still low.
+func (me *Logger) reclaimSpace() (bool, error) {
+	isLow, err := me.isLowSpace(me.archiveDir())
+	if err != nil || !isLow {
+		return false, err
+	}
+
+	oldFiles, err := me.oldLogFiles()
+	if err != nil {
+		return true, err
+	}
+	now := nowFn()
+	for i := len(oldFiles) - 1; i >= 0 && isLow; i-- {
+		f := oldFiles[i]
+		if !f.compressed || me.isHeld(f.fpath) {
+			continue
+		}
+		if me.MinArchiveAge > 0 && now.Sub(f.timestamp) < me.MinArchiveAge {
+			break
+		}
+		err := os.Remove(f.fpath)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return true, err
+		}
+		if err == nil {
+			os.Remove(f.fpath + pendingSuffix)
+			me.emit(Event{Kind: EventDelete, Path: f.fpath, CompressedSize: f.Size()})
+		}
+		if isLow, err = me.isLowSpace(me.archiveDir()); err != nil {
+			return true, err
+		}
+	}
+	return isLow, nil
+}
+
+// guardSpace is called before p is written. Should free space stay low after
+// deleting archives, it applies DiskFullPolicy, returning false if p is to be
+// discarded. Free space is only checked after spaceCheckInterval, or once MB
+// has been written since the last check. This must be called with me.mu held.
+func (me *Logger) guardSpace(p []byte) (bool, error) {
+	if !me.isSpaceGuarded() {
+		return true, nil
+	}
+	me.spaceUnchecked += int64(len(p))
+	if now := nowFn(); !now.Before(me.spaceCheckAt) || me.spaceUnchecked >= int64(MB) {
+		me.spaceCheckAt = now.Add(spaceCheckInterval)
+		me.spaceUnchecked = 0
+		me.checkSpace()
+
+		// The logfile is truncated once per check, rather than by every Write
+		if me.diskFull && me.DiskFullPolicy == DiskFullTruncate {
+			if err := me.truncateFile(); err != nil {
+				return true, err
+			}
+		}
+	}
+	if me.diskFull && me.DiskFullPolicy == DiskFullDrop {
+		me.countDropped(len(p))
+		return false, nil
+	}
+	return true, nil
+}
+
+// checkSpace deletes archives while free space is low, and records whether it stays
+// low, emitting an event as this starts or ends. This must be called with me.mu held.
+func (me *Logger) checkSpace() {
+	isLow, err := me.reclaimSpace()
+	if err == nil && me.archiveDirpath() != me.dirpath() {
+		// Archives deleted from ArchiveDir may not have freed space for the logfile
+		isLow, err = me.isLowSpace(filepath.Dir(me.Filepath))
+	}
+	if err != nil {
+		// This isn't worth failing the write over, nor reporting again until a check succeeds
+		if !me.spaceErr {
+			me.spaceErr = true
+			me.reportError(fmt.Errorf("error in tumble/guardSpace: %w", err))
+		}
+		return
+	}
+	me.spaceErr = false
+
+	if isLow && !me.diskFull {
+		me.emit(Event{Kind: EventDiskFull, Path: me.Filepath, Size: me.size})
+	} else if !isLow && me.diskFull {
+		me.emit(Event{Kind: EventDiskFree, Path: me.Filepath, Size: me.size})
+	}
+	me.diskFull = isLow
+}
+
+// truncateFile empties the logfile. This must be called with me.mu held.
+func (me *Logger) truncateFile() error {
+	f, ok := me.file.(*os.File)
+	if !ok {
+		return nil
+	}
+	if err := f.Truncate(0); err != nil {
+		return fmt.Errorf("can't truncate log file: %w", err)
+	}
+	me.size = 0
+	return nil
+}
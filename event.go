@@ -0,0 +1,89 @@
+package tumble
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// EventKind identifies what an Event describes.
+type EventKind int
+
+const (
+	EventRotateStart  EventKind = iota // The logfile is about to be rotated
+	EventRotateFinish                  // The logfile was renamed to an uncompressed archive (Path)
+	EventCompress                      // An archive (Path) was compressed from Size to CompressedSize bytes
+	EventDelete                        // An archive (Path) of CompressedSize bytes was deleted by retention
+	EventOpenError                     // The logfile (Path) could not be opened (Err)
+	EventError                         // Background work failed (Err). This is also passed to OnError.
+	EventReopen                        // The logfile (Path) was removed or replaced by another program after Size bytes, and reopened
+	EventDiskFull                      // Free space stayed low after deleting archives, so DiskFullPolicy applies to the logfile (Path) of Size bytes
+	EventArchive                       // OnArchive completed for an archive (Path) of CompressedSize bytes
+	EventDiskFree                      // Free space is no longer low, so DiskFullPolicy no longer applies to the logfile (Path) of Size bytes
+)
+
+func (me EventKind) String() string {
+	switch me {
+	case EventRotateStart:
+		return "rotate-start"
+	case EventRotateFinish:
+		return "rotate-finish"
+	case EventCompress:
+		return "compress"
+	case EventDelete:
+		return "delete"
+	case EventOpenError:
+		return "open-error"
+	case EventError:
+		return "error"
+	case EventReopen:
+		return "reopen"
+	case EventDiskFull:
+		return "disk-full"
+	case EventArchive:
+		return "archive"
+	case EventDiskFree:
+		return "disk-free"
+	}
+	return fmt.Sprintf("EventKind(%d)", int(me))
+}
+
+// Event is passed to Logger.OnEvent as the Logger rotates, compresses and
+// deletes files. Fields which do not apply to the Kind are left as zero.
+type Event struct {
+	Kind           EventKind
+	Time           time.Time
+	Path           string
+	Size           int64
+	CompressedSize int64
+	Err            error
+}
+
+func (me Event) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s %s", me.Time.UTC().Format(time.RFC3339Nano), me.Kind)
+	if me.Path != "" {
+		fmt.Fprintf(&sb, " path=%s", me.Path)
+	}
+	if me.Size != 0 {
+		fmt.Fprintf(&sb, " size=%d", me.Size)
+	}
+	if me.CompressedSize != 0 {
+		fmt.Fprintf(&sb, " compressed_size=%d", me.CompressedSize)
+	}
+	if me.Err != nil {
+		fmt.Fprintf(&sb, " err=%q", me.Err.Error())
+	}
+	return sb.String()
+}
+
+// emit passes the event to OnEvent, if set.
+func (me *Logger) emit(event Event) {
+	if me.OnEvent == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = nowFn()
+	}
+	me.OnEvent(event)
+}
@@ -2,21 +2,41 @@ package tumble
 
 import (
 	"errors"
-	"fmt"
+	"os"
 	"path/filepath"
-	"strconv"
 	"strings"
 	"time"
 )
 
+// Filestamper is a naming scheme for archives. It may be set on a Logger and
+// its Muster to name archives according to an existing convention.
+// TimestampFormat is the built-in implementation and the default.
+//
+// Names are given without a directory or compression suffix. For example, the
+// default names an archive of "foo.log" taken at ts (with seq 0) as
+// "foo-1699999999.log". Archives are ordered by ts and then by seq.
 type Filestamper interface {
+	// ArchiveName returns the name of an archive of the logfile named logName,
+	// taken at ts. The seq is 0 unless the name for each smaller seq is taken,
+	// and must give a distinct name.
+	ArchiveName(logName string, ts time.Time, seq int) string
+
+	// ParseArchiveName is the inverse of ArchiveName. It returns an error for any
+	// name which is not an archive of the logfile named logName.
+	ParseArchiveName(logName, archiveName string) (ts time.Time, seq int, err error)
+}
+
+// archiveNamer is implemented by Logger and Muster, which share the helpers below
+type archiveNamer interface {
 	filepath() string
 	dirpath() string
+	archiveDirpath() string
 	namePrefix() string
 	nameExt() string
+	compressSuffix() string
+	codecs() []Codec
+	filestamper() Filestamper
 	timestampToFpath(ts time.Time) string
-	timestampLength() int
-	parseTimestamp(s string) (time.Time, error)
 	fpathToTimestamp(fpath string) (time.Time, error)
 }
 
@@ -25,72 +45,153 @@ type Filestamper interface {
 //	        ""  in          "foo.log",
 //	     "tmp/  in      "tmp/foo.log"
 //	"/path/to/" in "/path/to/foo.log"
-func dirpath(this Filestamper) string {
+func dirpath(this archiveNamer) string {
 	if filepath.Dir(this.filepath()) == "." {
 		return ""
 	}
 	return filepath.Dir(this.filepath()) + "/"
 }
 
+// This is "/path/to/archives/" when archives are kept in their own archiveDir,
+// and otherwise the same as dirpath
+func archiveDirpath(this archiveNamer, archiveDir string) string {
+	if archiveDir == "" || filepath.Clean(archiveDir) == filepath.Dir(this.filepath()) {
+		return this.dirpath()
+	}
+	return filepath.Clean(archiveDir) + "/"
+}
+
+// archiveDirpaths are where archives are found: compressed archives in archiveDirpath,
+// and those yet to be compressed in dirpath, where the logfile is renamed on rotation
+func archiveDirpaths(this archiveNamer) []string {
+	if this.archiveDirpath() == this.dirpath() {
+		return []string{this.dirpath()}
+	}
+	return []string{this.archiveDirpath(), this.dirpath()}
+}
+
+// listArchiveDirs returns the path of each file in archiveDirpaths. An archiveDirpath
+// which doesn't exist yet has no files.
+func listArchiveDirs(this archiveNamer) ([]string, error) {
+	fpaths := []string{}
+	for _, dirpath := range archiveDirpaths(this) {
+		dir := dirpath
+		if dir == "" {
+			dir = "."
+		}
+		files, err := os.ReadDir(dir)
+		if errors.Is(err, os.ErrNotExist) && dirpath != this.dirpath() {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			if !f.IsDir() {
+				fpaths = append(fpaths, dirpath+f.Name())
+			}
+		}
+	}
+	return fpaths, nil
+}
+
 // This is "foo" in "/path/to/foo.log"
-func namePrefix(this Filestamper) string {
+func namePrefix(this archiveNamer) string {
 	return this.filepath()[len(this.dirpath()) : len(this.filepath())-len(this.nameExt())]
 }
 
 // This is ".log" in "/path/to/foo.log"
-func nameExt(this Filestamper) string {
+func nameExt(this archiveNamer) string {
 	return filepath.Ext(this.filepath())
 }
 
-func timestampToFpath(this Filestamper, ts time.Time) string {
-	return fmt.Sprintf("%s%s-%d%s%s", this.dirpath(), this.namePrefix(), ts.Unix(), this.nameExt(), compressSuffix)
+// This is "foo.log" in "/path/to/foo.log"
+func logName(this archiveNamer) string {
+	return this.namePrefix() + this.nameExt()
+}
+
+func filestamperOrDefault(filestamper Filestamper) Filestamper {
+	if filestamper == nil {
+		return TimestampFormat{}
+	}
+	return filestamper
 }
 
-func timestampLength(this Filestamper) int {
-	// Today we use a length-10 dateint (but this could be changed)
-	return 10
+// This is "/path/to/foo-1500000000.123456789.log" for an archive with this timestamp and seq
+// (or, e.g. "/path/to/foo.2017-07-14.000.log" with another Filestamper). It is uncompressed,
+// so is in dirpath rather than archiveDirpath.
+func timestampToBasepath(this archiveNamer, ts time.Time, seq int) string {
+	return this.dirpath() + this.filestamper().ArchiveName(logName(this), ts, seq)
 }
 
-func parseTimestamp(this Filestamper, s string) (time.Time, error) {
-	if len(s) != this.timestampLength() {
-		return time.Time{}, errors.New("invalid timestamp")
-	}
+func timestampToFpath(this archiveNamer, ts time.Time) string {
+	return this.archiveDirpath() + this.filestamper().ArchiveName(logName(this), ts, 0) + this.compressSuffix()
+}
 
-	secs, err := strconv.ParseInt(s, 10, 64)
-	if err != nil {
-		return time.Time{}, errors.New("invalid timestamp")
+// fpathToCodec returns the codec whose suffix ends fpath, preferring the longest match
+func fpathToCodec(this archiveNamer, fpath string) (Codec, error) {
+	var match Codec
+	for _, codec := range this.codecs() {
+		suffix := codec.Suffix()
+		if suffix == "" || !strings.HasSuffix(fpath, suffix) {
+			continue
+		}
+		if match == nil || len(suffix) > len(match.Suffix()) {
+			match = codec
+		}
+	}
+	if match == nil {
+		return nil, errors.New("mismatch")
 	}
+	return match, nil
+}
 
-	return time.Unix(secs, 0).UTC(), nil
+// fpathToTimestamp parses the timestamp of a compressed archive of any known codec.
+// The seq is folded in as nanoseconds so that the result orders archives.
+// Archives named with the default TimestampFormat are always recognised, so that
+// a new naming scheme can be adopted for an existing log.
+func fpathToTimestamp(this archiveNamer, fpath string) (time.Time, error) {
+	filestamper := this.filestamper()
+	ts, err := fpathToTimestampAs(this, filestamper, fpath)
+	if format, ok := filestamper.(TimestampFormat); err != nil && (!ok || format != TimestampFormat{}) {
+		ts, err = fpathToTimestampAs(this, TimestampFormat{}, fpath)
+	}
+	return ts, err
 }
 
-func fpathToTimestamp(this Filestamper, fpath string) (time.Time, error) {
-	dirpath := this.dirpath()
-	namePrefix := this.namePrefix()
-	nameExt := this.nameExt()
+// fpathToTimestampAs parses fpath as an archive in any of archiveDirpaths
+func fpathToTimestampAs(this archiveNamer, filestamper Filestamper, fpath string) (time.Time, error) {
+	for _, dirpath := range archiveDirpaths(this) {
+		if ts, err := fpathToTimestampIn(this, filestamper, dirpath, fpath); err == nil {
+			return ts, nil
+		}
+	}
+	return time.Time{}, errors.New("mismatch")
+}
 
-	// fpath must be exactly this long to possibly match
-	if len(fpath) != len(dirpath)+len(namePrefix)+len("-")+this.timestampLength()+len(nameExt)+len(compressSuffix) {
+func fpathToTimestampIn(this archiveNamer, filestamper Filestamper, dirpath, fpath string) (time.Time, error) {
+	// fpath must end with the suffix of a known codec
+	codec, err := fpathToCodec(this, fpath)
+	if err != nil {
 		return time.Time{}, errors.New("mismatch")
 	}
+	compressSuffix := codec.Suffix()
 
-	middle := fpath[len(dirpath)+len(namePrefix) : len(fpath)-len(nameExt)-len(compressSuffix)]
-
-	// middle should be a hyphen followed by a timestamp
-	if !strings.HasPrefix(middle, "-") {
+	// fpath must be in this directory
+	if !strings.HasPrefix(fpath, dirpath) || len(fpath) < len(dirpath)+len(compressSuffix) {
 		return time.Time{}, errors.New("mismatch")
 	}
+	name := fpath[len(dirpath) : len(fpath)-len(compressSuffix)]
 
-	// middle (after hyphen) should be exactly a timestamp
-	ts, err := this.parseTimestamp(middle[1:])
-	if err != nil {
+	ts, seq, err := filestamper.ParseArchiveName(logName(this), name)
+	if err != nil || seq < 0 {
 		return time.Time{}, errors.New("mismatch")
 	}
 
-	// finally, check that this is our log (rather than another with the same length)
-	if fpath != this.timestampToFpath(ts) {
+	// finally, check that this is our log (rather than another with the same shape)
+	if name != filestamper.ArchiveName(logName(this), ts, seq) {
 		return time.Time{}, errors.New("mismatch")
 	}
 
-	return ts, nil
+	return ts.Add(time.Duration(seq)), nil
 }
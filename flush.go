@@ -1,6 +1,9 @@
 package tumble
 
-import "io"
+import (
+	"io"
+	"os"
+)
 
 type FlusherError interface{ Flush() error }
 type FlusherVoid interface{ Flush() }
@@ -19,6 +22,18 @@ func Flush(wr io.Writer) error {
 	return nil
 }
 
+// Flush writes out any queued writes (see AsyncQueueBytes), then flushes the logfile
 func (me *Logger) Flush() error {
+	me.drainAsync()
+	me.mu.Lock()
+	defer me.mu.Unlock()
+
+	if me.closed {
+		return os.ErrClosed
+	}
+	return me.flush()
+}
+
+func (me *Logger) flush() error {
 	return Flush(me.file)
 }
@@ -1,3 +1,9 @@
 module github.com/rsanden/tumble
 
-go 1.17
+// github.com/klauspost/compress v1.18.0 requires go 1.22
+go 1.22
+
+require (
+	github.com/klauspost/compress v1.18.0
+	github.com/ulikunitz/xz v0.5.9
+)
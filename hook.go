@@ -0,0 +1,170 @@
+package tumble
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Archive is a compressed archive, as passed to OnArchive
+type Archive struct {
+	Path      string
+	Timestamp time.Time
+	Size      int64
+}
+
+// pendingSuffix marks an archive whose OnArchive or ArchiveSink is yet to complete, as "foo-1699999999.log.gz.pending"
+const pendingSuffix = ".pending"
+
+// archiveRetryDelay is the wait before retrying OnArchive, doubling with each retry
+var archiveRetryDelay = time.Second
+
+// archiveHookState is kept by the mill for a pending archive which failed, until it
+// is retried
+type archiveHookState struct {
+	attempts int
+	retryAt  time.Time
+}
+
+// markPending records that OnArchive or ArchiveSink is yet to complete for the archive
+// at fpath. This is done before it is compressed, so that even should the process exit,
+// it is never deleted before they complete (as isHeld).
+func (me *Logger) markPending(fpath string) error {
+	if err := me.makeArchiveDir(); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(fpath+pendingSuffix, os.O_CREATE|os.O_WRONLY, me.filePerm())
+	if err != nil {
+		return fmt.Errorf("can't mark archive pending: %w", err)
+	}
+	return f.Close()
+}
+
+// isPending reports whether OnArchive or ArchiveSink is yet to complete for the archive at fpath
+func (me *Logger) isPending(fpath string) bool {
+	if !me.isArchiveHooked() {
+		return false
+	}
+	_, err := os.Lstat(fpath + pendingSuffix)
+	return err == nil
+}
+
+// runArchiveHooks calls ArchiveSink and OnArchive for each pending archive, oldest first,
+// including those they failed for in an earlier run of the mill
+func (me *Logger) runArchiveHooks(files []logInfo) {
+	isPending := map[string]bool{}
+	for i := len(files) - 1; i >= 0; i-- {
+		if f := files[i]; me.isPending(f.fpath) {
+			isPending[f.fpath] = true
+			if err := me.runArchiveHook(f); err != nil {
+				me.reportError(fmt.Errorf("error in tumble/runArchiveHook: %w", err))
+			}
+		}
+	}
+
+	// Forget archives which are no longer pending (e.g. as retention deleted them)
+	for fpath := range me.hookStates {
+		if !isPending[fpath] {
+			delete(me.hookStates, fpath)
+		}
+	}
+}
+
+// runArchiveHook makes one attempt at a pending archive, unless it is waiting to be
+// retried. A failed attempt is retried by a later run of the mill (see scheduleRetry),
+// up to OnArchiveRetries times, and is only then reported. Once it succeeds, the
+// archive is no longer pending.
+func (me *Logger) runArchiveHook(f logInfo) error {
+	state := me.hookStates[f.fpath]
+	if state == nil {
+		state = &archiveHookState{}
+		me.hookStates[f.fpath] = state
+	}
+	now := time.Now()
+	if now.Before(state.retryAt) {
+		me.scheduleRetry(state.retryAt)
+		return nil
+	}
+	// An attempt which timed out may not have returned. It is never overlapped.
+	if me.isHookRunning(f.fpath) {
+		me.scheduleRetry(now.Add(archiveRetryDelay))
+		return nil
+	}
+
+	archive := Archive{Path: f.fpath, Timestamp: f.timestamp, Size: f.Size()}
+	if err := me.callArchiveHook(archive); err != nil {
+		state.attempts += 1
+		if state.attempts <= me.OnArchiveRetries {
+			state.retryAt = now.Add(archiveRetryDelay << (state.attempts - 1))
+			me.scheduleRetry(state.retryAt)
+			return nil
+		}
+		delete(me.hookStates, f.fpath)
+		return fmt.Errorf("archive hook failed for %s after %d attempt(s): %w", f.fpath, state.attempts, err)
+	}
+	delete(me.hookStates, f.fpath)
+
+	if err := os.Remove(f.fpath + pendingSuffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	me.emit(Event{Kind: EventArchive, Path: f.fpath, CompressedSize: f.Size()})
+	return nil
+}
+
+// scheduleRetry has the mill run again at retryAt (or earlier, for another archive)
+func (me *Logger) scheduleRetry(retryAt time.Time) {
+	if me.retryAt.IsZero() || retryAt.Before(me.retryAt) {
+		me.retryAt = retryAt
+	}
+}
+
+// isHookRunning reports whether an attempt for the archive at fpath has yet to return
+func (me *Logger) isHookRunning(fpath string) bool {
+	me.hookMu.Lock()
+	defer me.hookMu.Unlock()
+	return me.hookRunning[fpath]
+}
+
+// callArchiveHook calls hookArchive once, giving up after OnArchiveTimeout (if set)
+// even should it not heed its context. It is then still running until it returns.
+func (me *Logger) callArchiveHook(archive Archive) error {
+	if me.OnArchiveTimeout <= 0 {
+		return me.hookArchive(context.Background(), archive)
+	}
+
+	me.hookMu.Lock()
+	me.hookRunning[archive.Path] = true
+	me.hookMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), me.OnArchiveTimeout)
+	defer cancel()
+	errCh := make(chan error, 1)
+	go func() {
+		err := me.hookArchive(ctx, archive)
+		me.hookMu.Lock()
+		delete(me.hookRunning, archive.Path)
+		me.hookMu.Unlock()
+		errCh <- err
+	}()
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// hookArchive passes the archive to ArchiveSink and then OnArchive, whichever are set
+func (me *Logger) hookArchive(ctx context.Context, archive Archive) error {
+	if me.ArchiveSink != nil {
+		if err := me.putArchive(ctx, archive); err != nil {
+			return err
+		}
+	}
+	if me.OnArchive != nil {
+		return me.OnArchive(ctx, archive)
+	}
+	return nil
+}
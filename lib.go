@@ -1,8 +1,12 @@
 package tumble
 
 import (
+	"bufio"
+	"context"
 	"io"
+	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -15,6 +19,115 @@ import (
 //	maxTotalSizeMB: Total disk space of active log + compressed archives (in MB)
 //	formatFn:       Log message formatting function (optional)
 //
+// NewLoggerWithOptions is an alternative constructor, which sets fields through
+// options and checks them, returning an error rather than a Logger which can't
+// work as configured.
+//
+// RotateInterval may additionally be set (before the first Write) to rotate
+// the logfile on wall-clock boundaries even when MaxLogSizeMB is not reached.
+// Boundaries are multiples of the interval since the zero time, so 1*time.Hour
+// rotates on the hour and 24*time.Hour rotates at midnight UTC. This is checked
+// on every Write and by a background timer so idle logs still roll over.
+// An empty logfile is never rotated.
+//
+// Codec may be set (before the first Write) to choose how archives are
+// compressed. It defaults to gzip at its default level. Archives written with any built-in
+// codec are recognised by the mill and by Muster, so the codec may be changed
+// over the lifetime of a log.
+//
+// Retention may be further limited (before the first Write) by MaxArchiveAge
+// and MaxArchives. Archives are deleted when they exceed any one of these or
+// the MaxTotalSizeMB budget. MinArchiveAge is a floor: archives younger than
+// this are never deleted, even when over a limit. This is reported as
+// ErrRetentionFloor.
+//
+// OnError receives errors from background work (the mill and rotation timer).
+// OnEvent receives an Event as files are rotated, compressed and deleted, and
+// when the logfile can't be opened. Background errors are also passed to it.
+// If neither is set, background errors are printed to stderr. Both must be
+// goroutine-safe and must not call back into the Logger.
+//
+// Filestamper may be set (before the first Write) to name archives differently.
+// For example, a TimestampFormat with a human-readable layout rather than seconds
+// since epoch. If nil, the default TimestampFormat is used.
+//
+// FileLock may be set (before the first Write) to share the logfile between
+// Loggers in several processes, which must all set it. Each Write and rotation
+// then holds an advisory lock (flock) on a sidecar file, named Filepath+".lock",
+// and first picks up any rotation or writes made by the other processes.
+//
+// AsyncQueueBytes may be set (before the first Write) so that Write only copies
+// p into an in-memory queue of this many bytes, which a background goroutine
+// writes out. A slow disk then doesn't stall the caller. AsyncPolicy chooses
+// what happens when the queue is full: QueueBlock (the default) waits for room,
+// while QueueDropNewest and QueueDropOldest discard writes, counted by Dropped.
+// Errors are then reported as for background work. Flush, Rotate and Close
+// first write out the queue. FormatFn is applied as writes leave the queue.
+//
+// SyncPolicy may be set (before the first Write) to fsync the logfile, and its
+// directory, so that what survives a crash is explicit. By default (SyncNever),
+// this is left to the OS. SyncOnRotate syncs the logfile before it is closed,
+// and the directory after it is rotated or an archive is compressed. Each
+// further policy adds to this: SyncEveryBytes also syncs after each SyncBytes
+// written, SyncEveryInterval also syncs every SyncInterval, and SyncEveryWrite
+// also syncs after every Write. Sync may be called to do so at any time.
+//
+// RecordDelimiter may be set (before the first Write), e.g. to []byte("\n"), so
+// that a record is never split across a rotation, even when written in chunks.
+// Only the whole records in each Write are written out (each passed to FormatFn
+// on its own), with the rest buffered until completed by a later Write, or
+// written out by Close. Each archive then holds a self-contained set of whole
+// records. A partial record is also written out once it reaches MaxLogSizeMB.
+//
+// FileMode may be set (before the first Write) for new logfiles and archives,
+// rather than 0644 (less the umask). It is applied exactly, regardless of the
+// umask. Uid and Gid may be set to chown them, and are -1 (unchanged) by
+// default. DirMode may be set to create the logfile's missing parent
+// directories with this mode. They are then created again should they be
+// removed while the logfile is open, as a Write checks at most once a second.
+//
+// ReopenCheckInterval may be set (before the first Write) for a Write to check,
+// at most this often, whether Filepath still refers to the open logfile. Should
+// another program have removed or replaced it, it is reopened (at Filepath) and
+// an EventReopen is emitted. Otherwise, writes would be lost to the removed file
+// until the next rotation.
+//
+// MinFreeMB and/or MinFreePercent may be set (before the first Write) to keep
+// this much free space on the logfile's filesystem, whatever is using it. While
+// under either, the oldest archives are deleted (beyond the usual retention),
+// other than those younger than MinArchiveAge. Should that not be enough,
+// DiskFullPolicy decides what each Write does: write anyway (DiskFullWrite, the
+// default), discard the write (DiskFullDrop), or write after truncating the
+// logfile each time free space is checked (DiskFullTruncate). An EventDiskFull
+// is emitted as this starts, and an EventDiskFree as it ends. A Write checks free space at most once a second,
+// unless a MB has been written since the last check.
+//
+// ArchiveDir may be set (before the first Write) to keep compressed archives in
+// another directory, possibly on another filesystem. The logfile is still renamed
+// beside itself on rotation, and the mill then compresses it into ArchiveDir,
+// syncing the archive before removing the uncompressed file. ArchiveDir is
+// created (with DirMode, or 0755) if missing. Its Muster must have the same ArchiveDir.
+// Free space is then kept by deleting archives on ArchiveDir's filesystem.
+//
+// OnArchive may be set (before the first Write) to be called by the mill with
+// each archive once it is compressed, e.g. to copy it to other storage. Should
+// it return an error, the mill runs again to retry it up to OnArchiveRetries
+// times, waiting longer each time, and then reports the error. Each attempt is
+// given up after OnArchiveTimeout, if set, and ctx is then done, but no retry
+// starts until it returns. Until OnArchive succeeds, the archive is pending, as
+// marked by an empty file beside it (named with a ".pending" suffix), and is
+// never deleted. A pending archive is retried on each later run of the mill,
+// including by a new Logger after a restart, so OnArchive may see an archive
+// more than once. Close waits for one last attempt, but not to retry it. An
+// EventArchive is emitted as OnArchive succeeds.
+//
+// ArchiveSink may be set (before the first Write) for the mill to Put each
+// archive to it once compressed, e.g. an S3Sink to upload it to object storage,
+// or a LocalSink to copy it elsewhere. It is called before OnArchive, with the
+// same retries and timeout, and the archive is pending in the same way. Set
+// SinkBeforeDelete for retention to only delete an archive once ArchiveSink
+// has acknowledged it. Otherwise, an archive may be deleted while pending.
+//
 // FormatFn is a formatting function that processes input before it is written.
 // It is typically used to add a timestamp in a configurable format.
 // The buf parameter is a buffer to be modified and returned (prevents allocations).
@@ -54,34 +167,134 @@ import (
 //	defer logger.Close()
 //	log.SetOutput(logger)
 //
+// A Logger is safe for concurrent use. Write, Flush, Sync, Rotate, Reopen and
+// Close may be called from any goroutine. Once closed, all but Close return
+// os.ErrClosed; Close may be called again, and returns nil.
+//
 // Note: maxTotalSizeMB is not precise. It may be temporarily exceeded
 //
 //	during rotation by the amount of MaxLogSizeMB.
 type Logger struct {
-	Filepath       string
-	MaxLogSizeMB   uint64
-	MaxTotalSizeMB uint64
-	FormatFn       func(msg []byte, buf []byte) ([]byte, int)
+	Filepath            string
+	MaxLogSizeMB        uint64
+	MaxTotalSizeMB      uint64
+	FormatFn            func(msg []byte, buf []byte) ([]byte, int)
+	RotateInterval      time.Duration
+	Codec               Codec
+	MaxArchiveAge       time.Duration
+	MaxArchives         int
+	MinArchiveAge       time.Duration
+	OnError             func(err error)
+	OnEvent             func(event Event)
+	Filestamper         Filestamper
+	FileLock            bool
+	AsyncQueueBytes     int64
+	AsyncPolicy         QueuePolicy
+	SyncPolicy          SyncPolicy
+	SyncBytes           int64
+	SyncInterval        time.Duration
+	RecordDelimiter     []byte
+	FileMode            os.FileMode
+	DirMode             os.FileMode
+	Uid                 int
+	Gid                 int
+	ReopenCheckInterval time.Duration
+	MinFreeMB           uint64
+	MinFreePercent      float64
+	DiskFullPolicy      DiskFullPolicy
+	ArchiveDir          string
+	OnArchive           func(ctx context.Context, archive Archive) error
+	OnArchiveRetries    int
+	OnArchiveTimeout    time.Duration
+	ArchiveSink         ArchiveSink
+	SinkBeforeDelete    bool
 
-	file          io.WriteCloser
-	fileCloseOnce sync.Once
-	size          int64
-	millCh        chan struct{}
-	millClosingCh chan struct{}
-	millStopOnce  sync.Once
-	millCloseOnce sync.Once
-	millWG        sync.WaitGroup
-	fmtbuf        []byte
+	mu             sync.Mutex
+	file           io.WriteCloser
+	fileCloseOnce  sync.Once
+	size           int64
+	rotateAt       time.Time
+	timerStartOnce sync.Once
+	timerStopOnce  sync.Once
+	timerStopCh    chan struct{}
+	timerWG        sync.WaitGroup
+	millCh         chan struct{}
+	millClosingCh  chan struct{}
+	millStopOnce   sync.Once
+	millCloseOnce  sync.Once
+	millWG         sync.WaitGroup
+	fmtbuf         []byte
+	lockFd         *os.File
+	closed         bool
+	asyncMu        sync.Mutex
+	asyncCond      *sync.Cond
+	asyncStartOnce sync.Once
+	asyncWG        sync.WaitGroup
+	asyncClosing   bool
+	asyncQueued    uint64
+	asyncWritten   uint64
+	queue          [][]byte
+	queueBytes     int64
+	droppedWrites  uint64
+	droppedBytes   uint64
+	unsynced       int64
+	syncStartOnce  sync.Once
+	syncStopOnce   sync.Once
+	syncStopCh     chan struct{}
+	syncWG         sync.WaitGroup
+	partial        []byte
+	reopenCheckAt  time.Time
+	diskFull       bool
+	spaceCheckAt   time.Time
+	spaceUnchecked int64
+	spaceErr       bool
+	dirCheckAt     time.Time
+	hookMu         sync.Mutex
+	hookRunning    map[string]bool
+	hookStates     map[string]*archiveHookState
+	retryAt        time.Time
 }
 
 // Muster is an io.ReadCloser which produces the full history of
 // the given log file and its archives seamlessly and in order.
+//
+// Filestamper and ArchiveDir must match those used by the Logger. Archives written
+// with any built-in codec are read, and Codecs may be set to also read those
+// written with other codecs.
+//
+// If Follow is set, Read does not return io.EOF at the end of the logfile.
+// Instead, it waits for more to be written (like tail -f). When the logfile
+// is rotated, the renamed file is read to its end before moving on to the
+// new logfile. Close may be called from another goroutine to end a waiting
+// Read, which then returns io.EOF.
+//
+// Since and Until, if set, limit the history to this window. Archives which
+// fall entirely outside of it (by their timestamps) are skipped. If lines were
+// written with a timestamp prefix (as "<time> : <msg>"), LineTimeFormat may be
+// set to its layout to also skip lines outside of the window. For lines in other
+// formats, LineTimeFn may be set instead to return a line's timestamp, or false
+// if it has none. SlogLineTime does so for records written by NewJSONHandler.
 type Muster struct {
-	Filepath string
+	Filepath       string
+	Filestamper    Filestamper
+	ArchiveDir     string
+	Codecs         []Codec
+	Follow         bool
+	Since          time.Time
+	Until          time.Time
+	LineTimeFormat string
+	LineTimeFn     func(line []byte) (time.Time, bool)
 
 	latestTs           time.Time
 	unreadyTs          time.Time
+	newestArchiveTs    time.Time
 	openArchives       []io.Closer
 	archiveMultireader io.Reader
-	lastOpenFile       io.ReadCloser
+	lastOpenFile       *os.File
+	closed             atomic.Bool
+	lineReader         *bufio.Reader
+	lineBuf            []byte
+	lineErr            error
+	lineKeep           bool
+	mu                 sync.Mutex
 }
@@ -0,0 +1,80 @@
+package tumble
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// lockSuffix is appended to Filepath to name the sidecar file used for FileLock
+const lockSuffix = ".lock"
+
+// lockFile takes the inter-process lock if FileLock is set, and then picks up any
+// changes to the logfile made by other processes. The returned function releases it.
+// This must be called with me.mu held.
+func (me *Logger) lockFile() (func(), error) {
+	if !me.FileLock {
+		return func() {}, nil
+	}
+
+	if me.lockFd == nil {
+		if err := me.makeDir(); err != nil {
+			return nil, err
+		}
+		f, err := os.OpenFile(me.Filepath+lockSuffix, os.O_CREATE|os.O_RDWR, me.filePerm())
+		if err != nil {
+			return nil, fmt.Errorf("can't open lock file: %w", err)
+		}
+		me.lockFd = f
+	}
+
+	if err := flock(me.lockFd, syscall.LOCK_EX); err != nil {
+		return nil, fmt.Errorf("can't lock logfile: %w", err)
+	}
+	unlock := func() {
+		flock(me.lockFd, syscall.LOCK_UN)
+	}
+
+	if err := me.refreshFile(); err != nil {
+		unlock()
+		return nil, err
+	}
+	return unlock, nil
+}
+
+func flock(f *os.File, how int) error {
+	for {
+		err := syscall.Flock(int(f.Fd()), how)
+		if err != syscall.EINTR {
+			return err
+		}
+	}
+}
+
+// refreshFile closes the logfile if another process has rotated (or removed) it,
+// so that the current one is opened on the next Write. Otherwise, the size is
+// refreshed to include what other processes have written.
+func (me *Logger) refreshFile() error {
+	f, ok := me.file.(*os.File)
+	if !ok {
+		return nil
+	}
+	openInfo, err := f.Stat()
+	if err == nil {
+		pathInfo, err := os.Stat(me.Filepath)
+		if err == nil && os.SameFile(openInfo, pathInfo) {
+			me.size = openInfo.Size()
+			return nil
+		}
+	}
+	return me.closeFile()
+}
+
+func (me *Logger) closeLockFile() error {
+	if me.lockFd == nil {
+		return nil
+	}
+	err := me.lockFd.Close()
+	me.lockFd = nil
+	return err
+}
@@ -1,7 +1,9 @@
 package tumble
 
 import (
+	"fmt"
 	"io"
+	"os"
 	"path/filepath"
 	"sync"
 	"time"
@@ -10,54 +12,197 @@ import (
 const (
 	compressSuffix = ".gz"
 	fileMode       = 0644
+	archiveDirMode = 0755
 )
 
 var _ io.WriteCloser = (*Logger)(nil) // Implement io.WriteCloser
-var _ Filestamper = (*Logger)(nil)    // Implement Filestamper
+var _ archiveNamer = (*Logger)(nil)   // Implement archiveNamer
 
 var (
 	// These constants are mocked out by tests
-	nowFn = time.Now
-	MB    = uint64(1024 * 1024)
+	nowFn       = time.Now
+	MB          = uint64(1024 * 1024)
+	diskSpaceFn = diskSpace
 )
 
 func NewLogger(fpath string, maxLogSizeMB, maxTotalSizeMB uint64, formatFn func(msg []byte, buf []byte) ([]byte, int)) *Logger {
+	logger := newLogger(fpath, maxLogSizeMB, maxTotalSizeMB, formatFn)
+	logger.start()
+	return logger
+}
+
+// newLogger returns a Logger whose background work is not yet started
+func newLogger(fpath string, maxLogSizeMB, maxTotalSizeMB uint64, formatFn func(msg []byte, buf []byte) ([]byte, int)) *Logger {
 	logger := &Logger{
-		/* Filepath:       */ filepath.Clean(fpath),
-		/* MaxLogSizeMB:   */ maxLogSizeMB,
-		/* MaxTotalSizeMB: */ maxTotalSizeMB,
-		/* FormatFn:       */ formatFn,
+		/* Filepath:            */ filepath.Clean(fpath),
+		/* MaxLogSizeMB:        */ maxLogSizeMB,
+		/* MaxTotalSizeMB:      */ maxTotalSizeMB,
+		/* FormatFn:            */ formatFn,
+		/* RotateInterval:      */ 0,
+		/* Codec:               */ nil,
+		/* MaxArchiveAge:       */ 0,
+		/* MaxArchives:         */ 0,
+		/* MinArchiveAge:       */ 0,
+		/* OnError:             */ nil,
+		/* OnEvent:             */ nil,
+		/* Filestamper:         */ nil,
+		/* FileLock:            */ false,
+		/* AsyncQueueBytes:     */ 0,
+		/* AsyncPolicy:         */ QueueBlock,
+		/* SyncPolicy:          */ SyncNever,
+		/* SyncBytes:           */ 0,
+		/* SyncInterval:        */ 0,
+		/* RecordDelimiter:     */ nil,
+		/* FileMode:            */ 0,
+		/* DirMode:             */ 0,
+		/* Uid:                 */ -1,
+		/* Gid:                 */ -1,
+		/* ReopenCheckInterval: */ 0,
+		/* MinFreeMB:           */ 0,
+		/* MinFreePercent:      */ 0,
+		/* DiskFullPolicy:      */ DiskFullWrite,
+		/* ArchiveDir:          */ "",
+		/* OnArchive:           */ nil,
+		/* OnArchiveRetries:    */ 0,
+		/* OnArchiveTimeout:    */ 0,
+		/* ArchiveSink:         */ nil,
+		/* SinkBeforeDelete:    */ false,
 
-		/* file:           */ nil,
-		/* fileCloseOnce:  */ sync.Once{},
-		/* size:           */ 0,
-		/* millCh:         */ make(chan struct{}, 2),
-		/* millClosingCh:  */ make(chan struct{}),
-		/* millStopOnce:   */ sync.Once{},
-		/* millCloseOnce:  */ sync.Once{},
-		/* millWG:         */ sync.WaitGroup{},
-		/* fmtbuf:         */ nil,
+		/* mu:                  */ sync.Mutex{},
+		/* file:                */ nil,
+		/* fileCloseOnce:       */ sync.Once{},
+		/* size:                */ 0,
+		/* rotateAt:            */ time.Time{},
+		/* timerStartOnce:      */ sync.Once{},
+		/* timerStopOnce:       */ sync.Once{},
+		/* timerStopCh:         */ make(chan struct{}),
+		/* timerWG:             */ sync.WaitGroup{},
+		/* millCh:              */ make(chan struct{}, 2),
+		/* millClosingCh:       */ make(chan struct{}),
+		/* millStopOnce:        */ sync.Once{},
+		/* millCloseOnce:       */ sync.Once{},
+		/* millWG:              */ sync.WaitGroup{},
+		/* fmtbuf:              */ nil,
+		/* lockFd:              */ nil,
+		/* closed:              */ false,
+		/* asyncMu:             */ sync.Mutex{},
+		/* asyncCond:           */ nil,
+		/* asyncStartOnce:      */ sync.Once{},
+		/* asyncWG:             */ sync.WaitGroup{},
+		/* asyncClosing:        */ false,
+		/* asyncQueued:         */ 0,
+		/* asyncWritten:        */ 0,
+		/* queue:               */ nil,
+		/* queueBytes:          */ 0,
+		/* droppedWrites:       */ 0,
+		/* droppedBytes:        */ 0,
+		/* unsynced:            */ 0,
+		/* syncStartOnce:       */ sync.Once{},
+		/* syncStopOnce:        */ sync.Once{},
+		/* syncStopCh:          */ make(chan struct{}),
+		/* syncWG:              */ sync.WaitGroup{},
+		/* partial:             */ nil,
+		/* reopenCheckAt:       */ time.Time{},
+		/* diskFull:            */ false,
+		/* spaceCheckAt:        */ time.Time{},
+		/* spaceUnchecked:      */ 0,
+		/* spaceErr:            */ false,
+		/* dirCheckAt:          */ time.Time{},
+		/* hookMu:              */ sync.Mutex{},
+		/* hookRunning:         */ map[string]bool{},
+		/* hookStates:          */ map[string]*archiveHookState{},
+		/* retryAt:             */ time.Time{},
 	}
+	logger.asyncCond = sync.NewCond(&logger.asyncMu)
+	return logger
+}
 
-	logger.millWG.Add(1)
-	go logger.millRun()
+func (me *Logger) start() {
+	me.millWG.Add(1)
+	go me.millRun()
+}
 
-	return logger
+// reportError passes background errors (from the mill or rotation timer)
+// to OnError and OnEvent, or prints them to stderr if neither is set.
+func (me *Logger) reportError(err error) {
+	if me.OnError == nil && me.OnEvent == nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	if me.OnError != nil {
+		me.OnError(err)
+	}
+	me.emit(Event{Kind: EventError, Err: err})
+}
+
+func (me *Logger) codec() Codec {
+	if me.Codec == nil {
+		return defaultCodec
+	}
+	return me.Codec
 }
 
 func (me *Logger) Write(p []byte) (n int, err error) {
+	if me.isAsync() {
+		return me.writeAsync(p)
+	}
+	return me.write(p)
+}
+
+func (me *Logger) write(p []byte) (n int, err error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+
+	if me.closed {
+		return 0, os.ErrClosed
+	}
+
+	unlock, err := me.lockFile()
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	if me.RecordDelimiter != nil {
+		return me.writeRecords(p)
+	}
+	return me.writeFile(p)
+}
+
+// writeFile writes p to the logfile, rotating first if due.
+// This must be called with me.mu held.
+func (me *Logger) writeFile(p []byte) (n int, err error) {
 	writeLen := int64(len(p))
 
+	if err := me.checkReplaced(len(p)); err != nil {
+		return 0, err
+	}
 	if me.file == nil {
 		if err = me.openExistingOrNew(len(p)); err != nil {
 			return 0, err
 		}
-	} else if me.size+writeLen > int64(me.MaxLogSizeMB*MB) {
+	} else if me.isDirRemoved() {
+		// The logfile was removed along with its directory. Start it again.
+		if err := me.closeFile(); err != nil {
+			return 0, err
+		}
+		if err = me.openExistingOrNew(len(p)); err != nil {
+			return 0, err
+		}
+	} else if me.size+writeLen > int64(me.MaxLogSizeMB*MB) || me.isRotateDue() {
 		if err := me.rotate(); err != nil {
 			return 0, err
 		}
 	}
 
+	isWrite, err := me.guardSpace(p)
+	if err != nil {
+		return 0, err
+	}
+	if !isWrite {
+		return len(p), nil
+	}
+
 	var msg []byte
 	var msgIdx int
 	if me.FormatFn != nil {
@@ -70,6 +215,9 @@ func (me *Logger) Write(p []byte) (n int, err error) {
 
 	n, err = me.file.Write(msg)
 	me.size += int64(n)
+	if syncErr := me.syncAfterWrite(n); err == nil {
+		err = syncErr
+	}
 	if me.FormatFn != nil {
 		// Return length of p consumed
 		if n < msgIdx {
@@ -90,7 +238,11 @@ func (me *Logger) closeFile() error {
 		return nil
 	}
 
-	if err := me.Flush(); ERR == nil {
+	flush := me.flush
+	if me.isSync() {
+		flush = me.syncFile
+	}
+	if err := flush(); ERR == nil {
 		ERR = err
 	}
 
@@ -104,7 +256,19 @@ func (me *Logger) closeFile() error {
 func (me *Logger) Close() error {
 	var err error
 	me.fileCloseOnce.Do(func() {
-		err = me.closeFile()
+		me.stopAsync()
+		me.stopRotateTimer()
+		me.stopSyncTimer()
+		me.mu.Lock()
+		me.closed = true
+		err = me.writePartial()
+		if closeErr := me.closeFile(); err == nil {
+			err = closeErr
+		}
+		if lockErr := me.closeLockFile(); err == nil {
+			err = lockErr
+		}
+		me.mu.Unlock()
 	})
 	me.StopMill()
 	me.millCloseOnce.Do(func() {
@@ -113,11 +277,64 @@ func (me *Logger) Close() error {
 	return err
 }
 
-func (me *Logger) RotateClose() error {
-	// We must sleep 1 second before any forced rotate to prevent potential clobbering.
-	time.Sleep(1 * time.Second)
+// Rotate renames the logfile to an archive and opens a new one, as when it
+// reaches MaxLogSizeMB. It may be called concurrently with Write.
+func (me *Logger) Rotate() error {
+	me.drainAsync()
+	me.mu.Lock()
+	defer me.mu.Unlock()
+
+	if me.closed {
+		return os.ErrClosed
+	}
+
+	unlock, err := me.lockFile()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
-	rotateErr := me.rotate()
+	me.startRotateTimer()
+	return me.rotate()
+}
+
+// Reopen closes the logfile and opens Filepath again, without renaming it.
+// This is for external tools (such as logrotate) which move the logfile away
+// and then signal the writer. It may be called concurrently with Write.
+func (me *Logger) Reopen() error {
+	me.drainAsync()
+	me.mu.Lock()
+	defer me.mu.Unlock()
+
+	if me.closed {
+		return os.ErrClosed
+	}
+
+	unlock, err := me.lockFile()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := me.closeFile(); err != nil {
+		return err
+	}
+	return me.openExistingOrNew(0)
+}
+
+func (me *Logger) RotateClose() error {
+	me.drainAsync()
+	me.mu.Lock()
+	unlock, rotateErr := me.lockFile()
+	if rotateErr == nil {
+		if me.closed {
+			rotateErr = os.ErrClosed
+		} else {
+			rotateErr = me.rotate()
+		}
+		unlock()
+	}
+	me.mu.Unlock()
 	closeErr := me.Close()
 	if rotateErr != nil {
 		return rotateErr
@@ -10,6 +10,10 @@ func (me *Logger) dirpath() string {
 	return dirpath(me)
 }
 
+func (me *Logger) archiveDirpath() string {
+	return archiveDirpath(me, me.ArchiveDir)
+}
+
 func (me *Logger) namePrefix() string {
 	return namePrefix(me)
 }
@@ -18,16 +22,20 @@ func (me *Logger) nameExt() string {
 	return nameExt(me)
 }
 
-func (me *Logger) timestampToFpath(ts time.Time) string {
-	return timestampToFpath(me, ts)
+func (me *Logger) compressSuffix() string {
+	return me.codec().Suffix()
 }
 
-func (me *Logger) timestampLength() int {
-	return timestampLength(me)
+func (me *Logger) codecs() []Codec {
+	return append([]Codec{me.codec()}, builtinCodecs...)
 }
 
-func (me *Logger) parseTimestamp(s string) (time.Time, error) {
-	return parseTimestamp(me, s)
+func (me *Logger) filestamper() Filestamper {
+	return filestamperOrDefault(me.Filestamper)
+}
+
+func (me *Logger) timestampToFpath(ts time.Time) string {
+	return timestampToFpath(me, ts)
 }
 
 func (me *Logger) fpathToTimestamp(fpath string) (time.Time, error) {
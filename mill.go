@@ -1,20 +1,24 @@
 package tumble
 
 import (
-	"compress/gzip"
+	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"os"
 	"path/filepath"
 	"sort"
-	"strings"
 	"time"
 )
 
+// ErrRetentionFloor is reported when archives exceed the retention limits
+// but are kept anyway because they are younger than MinArchiveAge.
+var ErrRetentionFloor = errors.New("archives over retention limits are younger than MinArchiveAge")
+
 type logInfo struct {
 	os.FileInfo
-	timestamp time.Time
+	fpath      string
+	timestamp  time.Time
+	compressed bool
 }
 
 type byFormatTime []logInfo
@@ -29,8 +33,13 @@ func (b byFormatTime) Less(i, j int) bool {
 	return b[i].timestamp.After(b[j].timestamp)
 }
 
-func compressLogFile(src string) (err error) {
-	dst := src + compressSuffix
+// compressLogFile compresses src into an archive with the Logger's codec, mode and owner
+func (me *Logger) compressLogFile(src string) (err error) {
+	codec := me.codec()
+	dst := me.compressedFpath(src)
+	if err := me.makeArchiveDir(); err != nil {
+		return err
+	}
 
 	f, err := os.Open(src)
 	if err != nil {
@@ -38,70 +47,113 @@ func compressLogFile(src string) (err error) {
 	}
 	defer f.Close()
 
-	_, err = os.Stat(src)
+	info, err := os.Stat(src)
 	if err != nil {
 		return fmt.Errorf("failed to stat log file: %w", err)
 	}
 
-	// If this file already exists, we presume it was created by
-	// a previous attempt to compress the log file.
-	gzf, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.FileMode(fileMode))
+	// We compress into a temporary file which is renamed into place once complete.
+	// This way, a partial archive is never seen, and should another process's mill
+	// compress the same log file, the result is the same.
+	dstFile, err := os.CreateTemp(filepath.Dir(dst), filepath.Base(dst)+".*.tmp")
 	if err != nil {
 		return fmt.Errorf("failed to open compressed log file: %w", err)
 	}
-	defer gzf.Close()
-
-	gz := gzip.NewWriter(gzf)
+	defer dstFile.Close()
 
 	defer func() {
 		if err != nil {
-			os.Remove(dst)
+			os.Remove(dstFile.Name())
 			err = fmt.Errorf("failed to compress log file: %w", err)
 		}
 	}()
 
-	if _, err := io.Copy(gz, f); err != nil {
+	// CreateTemp uses 0600, so unless FileMode is set, the archive takes the log file's mode
+	if err := me.setPerm(dstFile, info.Mode().Perm()); err != nil {
+		return err
+	}
+
+	zw, err := codec.NewWriter(dstFile)
+	if err != nil {
 		return err
 	}
-	if err := gz.Close(); err != nil {
+
+	if _, err := io.Copy(zw, f); err != nil {
 		return err
 	}
-	if err := gzf.Close(); err != nil {
+	if err := zw.Close(); err != nil {
 		return err
 	}
+	// The log file is removed below, so its archive (and its name, in the directory)
+	// must be durable first. This is always so for an archive in ArchiveDir, which
+	// may be on another filesystem.
+	isArchiveDir := me.archiveDirpath() != me.dirpath()
+	if me.isSync() || isArchiveDir {
+		if err := dstFile.Sync(); err != nil {
+			return err
+		}
+	}
+	if err := dstFile.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(dstFile.Name(), dst); err != nil {
+		return err
+	}
+	if me.isSync() || isArchiveDir {
+		if err := syncDir(filepath.Dir(dst)); err != nil {
+			return err
+		}
+	}
 
 	if err := f.Close(); err != nil {
 		return err
 	}
-	if err := os.Remove(src); err != nil {
+	if err := os.Remove(src); err != nil && !errors.Is(err, os.ErrNotExist) {
 		return err
 	}
 
+	if me.isSync() {
+		return syncDir(filepath.Dir(src))
+	}
 	return nil
 }
 
+// compressedFpath is the archive which src, an uncompressed archive, is compressed into
+func (me *Logger) compressedFpath(src string) string {
+	return me.archiveDirpath() + filepath.Base(src) + me.compressSuffix()
+}
+
 func (me *Logger) oldLogFiles() ([]logInfo, error) {
-	files, err := ioutil.ReadDir(filepath.Dir(me.Filepath))
+	fpaths, err := listArchiveDirs(me)
+	if errors.Is(err, os.ErrNotExist) && me.DirMode != 0 {
+		// The directory is yet to be (re)created, so there are no archives
+		return nil, nil
+	}
 	if err != nil {
 		return nil, fmt.Errorf("can't read log file directory: %w", err)
 	}
 	logFiles := []logInfo{}
 
-	dirpath := me.dirpath()
-	for _, f := range files {
-		if f.IsDir() {
-			continue
+	for _, fpath := range fpaths {
+		ts, err := me.fpathToTimestamp(fpath)
+		compressed := err == nil
+		if !compressed {
+			ts, err = me.fpathToTimestamp(fpath + me.compressSuffix())
 		}
-		if ts, err := me.fpathToTimestamp(dirpath + f.Name()); err == nil {
-			logFiles = append(logFiles, logInfo{f, ts})
+		if err != nil {
+			// error parsing means that the suffix at the end was not generated
+			// by us, and therefore it's not a backup file.
 			continue
 		}
-		if ts, err := me.fpathToTimestamp(dirpath + f.Name() + compressSuffix); err == nil {
-			logFiles = append(logFiles, logInfo{f, ts})
+		f, err := os.Lstat(fpath)
+		if errors.Is(err, os.ErrNotExist) {
+			// Another process's mill may have got to it first
 			continue
 		}
-		// error parsing means that the suffix at the end was not generated
-		// by us, and therefore it's not a backup file.
+		if err != nil {
+			return nil, fmt.Errorf("can't stat log file: %w", err)
+		}
+		logFiles = append(logFiles, logInfo{f, fpath, ts, compressed})
 	}
 
 	sort.Sort(byFormatTime(logFiles))
@@ -109,6 +161,15 @@ func (me *Logger) oldLogFiles() ([]logInfo, error) {
 	return logFiles, nil
 }
 
+// archiveBudget is the space for compressed archives (MaxTotalSizeMB - MaxLogSizeMB), in bytes.
+// There is none when MaxTotalSizeMB doesn't exceed MaxLogSizeMB.
+func (me *Logger) archiveBudget() int64 {
+	if me.MaxTotalSizeMB <= me.MaxLogSizeMB {
+		return 0
+	}
+	return int64((me.MaxTotalSizeMB - me.MaxLogSizeMB) * MB)
+}
+
 func (me *Logger) millRunOnce() error {
 	oldFiles, err := me.oldLogFiles()
 	if err != nil {
@@ -118,24 +179,38 @@ func (me *Logger) millRunOnce() error {
 	// It is possible to have both an uncompressed and (partially) compressed file for the same log
 	// In this case, we overwrite the compressed file with a new one in compressLogFile().
 	// We overwrite keys over two passes on a map to ensure that logInfo entries are the current ones.
-	compressedMap := make(map[time.Time]logInfo)
+	// Keys are paths so that archives of different codecs are all accounted for.
+	compressedMap := make(map[string]logInfo)
 	for _, f := range oldFiles {
-		if strings.HasSuffix(f.Name(), compressSuffix) {
-			compressedMap[f.timestamp] = f
+		if f.compressed {
+			compressedMap[f.fpath] = f
 		}
 	}
 	for _, f := range oldFiles {
-		if !strings.HasSuffix(f.Name(), compressSuffix) {
-			fn := filepath.Join(filepath.Dir(me.Filepath), f.Name())
-			err := compressLogFile(fn)
+		if !f.compressed {
+			if me.isArchiveHooked() {
+				if err := me.markPending(me.compressedFpath(f.fpath)); err != nil {
+					return err
+				}
+			}
+			// Another process's mill may have got to this log file first.
+			err := me.compressLogFile(f.fpath)
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
 			if err != nil {
 				return err
 			}
-			fi, err := os.Stat(fn + compressSuffix)
+			dst := me.compressedFpath(f.fpath)
+			fi, err := os.Stat(dst)
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
 			if err != nil {
 				return err
 			}
-			compressedMap[f.timestamp] = logInfo{fi, f.timestamp}
+			compressedMap[dst] = logInfo{fi, dst, f.timestamp, true}
+			me.emit(Event{Kind: EventCompress, Path: dst, Size: f.Size(), CompressedSize: fi.Size()})
 		}
 	}
 
@@ -148,17 +223,51 @@ func (me *Logger) millRunOnce() error {
 	}
 	sort.Sort(byFormatTime(compressedFiles))
 
+	// ArchiveSink and OnArchive are called for pending archives. Retention skips any still held pending.
+	me.runArchiveHooks(compressedFiles)
+
+	// Archives are also discarded once they are older than MaxArchiveAge or beyond the
+	// newest MaxArchives, whichever limit is most restrictive. However, any archive younger
+	// than MinArchiveAge is kept regardless. This is reported as ErrRetentionFloor.
+	now := nowFn()
 	totalSizeBytes := int64(0)
-	for _, f := range compressedFiles {
+	floorCount, floorBytes := 0, int64(0)
+	for i, f := range compressedFiles {
 		totalSizeBytes += f.Size()
-		if totalSizeBytes > int64((me.MaxTotalSizeMB-me.MaxLogSizeMB)*MB) {
-			err := os.Remove(filepath.Join(filepath.Dir(me.Filepath), f.Name()))
-			if err != nil {
-				return err
-			}
+		isOverSize := totalSizeBytes > me.archiveBudget()
+		isOverAge := me.MaxArchiveAge > 0 && now.Sub(f.timestamp) > me.MaxArchiveAge
+		isOverCount := me.MaxArchives > 0 && i >= me.MaxArchives
+		if !isOverSize && !isOverAge && !isOverCount {
+			continue
+		}
+		if me.MinArchiveAge > 0 && now.Sub(f.timestamp) < me.MinArchiveAge {
+			floorCount += 1
+			floorBytes += f.Size()
+			continue
+		}
+		if me.isHeld(f.fpath) {
+			continue
+		}
+		err := os.Remove(f.fpath)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		os.Remove(f.fpath + pendingSuffix)
+		me.emit(Event{Kind: EventDelete, Path: f.fpath, CompressedSize: f.Size()})
+	}
+
+	if me.isSpaceGuarded() {
+		if _, err := me.reclaimSpace(); err != nil {
+			return err
 		}
 	}
 
+	if floorCount > 0 {
+		return fmt.Errorf("%w: kept %d archive(s) totalling %d bytes", ErrRetentionFloor, floorCount, floorBytes)
+	}
 	return nil
 }
 
@@ -178,22 +287,41 @@ func (me *Logger) drainMillCh() {
 func (me *Logger) millRun() {
 	defer me.millWG.Done()
 
+	// The mill also runs at retryAt, should a run schedule a retry (see scheduleRetry)
+	retryTimer := time.NewTimer(time.Hour)
+	stopRetryTimer := func() {
+		if !retryTimer.Stop() {
+			select {
+			case <-retryTimer.C:
+			default:
+			}
+		}
+	}
+	stopRetryTimer()
+	defer retryTimer.Stop()
+
 	isClosing := false
 	for {
 		select {
 		case <-me.millClosingCh:
 			isClosing = true
 		case <-me.millCh:
+		case <-retryTimer.C:
 		}
 
 		me.drainMillCh()
+		stopRetryTimer()
+		me.retryAt = time.Time{}
 		if err := me.millRunOnce(); err != nil {
-			fmt.Fprintln(os.Stderr, "error in tumble/millRunOnce:", err)
+			me.reportError(fmt.Errorf("error in tumble/millRunOnce: %w", err))
 		}
 
 		if isClosing {
 			return
 		}
+		if !me.retryAt.IsZero() {
+			retryTimer.Reset(time.Until(me.retryAt))
+		}
 	}
 }
 
@@ -1,13 +1,14 @@
 package tumble
 
 import (
-	"compress/gzip"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"sort"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
@@ -17,17 +18,32 @@ const SLEEP_TIME = 100 * time.Millisecond
 var FUTURE_TIMESTAMP = time.Unix(999999999999, 0).UTC()
 
 var _ io.ReadCloser = (*Muster)(nil) // Implement io.ReadCloser
-var _ Filestamper = (*Muster)(nil)   // Implement Filestamper
+var _ archiveNamer = (*Muster)(nil)  // Implement archiveNamer
 
 func NewMuster(fpath string) *Muster {
 	muster := &Muster{
 		/* Filepath:           */ filepath.Clean(fpath),
+		/* Filestamper:        */ nil,
+		/* ArchiveDir:         */ "",
+		/* Codecs:             */ nil,
+		/* Follow:             */ false,
+		/* Since:              */ time.Time{},
+		/* Until:              */ time.Time{},
+		/* LineTimeFormat:     */ "",
+		/* LineTimeFn:         */ nil,
 
 		/* latestTs:           */ time.Time{},
 		/* unreadyTs:          */ FUTURE_TIMESTAMP,
+		/* newestArchiveTs:    */ time.Time{},
 		/* openArchives:       */ nil,
 		/* archiveMultireader: */ nil,
 		/* lastOpenFile:       */ nil,
+		/* closed:             */ atomic.Bool{},
+		/* lineReader:         */ nil,
+		/* lineBuf:            */ nil,
+		/* lineErr:            */ nil,
+		/* lineKeep:           */ false,
+		/* mu:                 */ sync.Mutex{},
 	}
 	return muster
 }
@@ -41,8 +57,15 @@ func getOpenFilesLimit() uint64 {
 	return rlimit.Cur
 }
 
-func (me *Muster) getNewTimestamps() ([]time.Time, error) {
-	files, err := os.ReadDir(filepath.Dir(me.Filepath))
+// archiveFile is a compressed archive found by Muster
+type archiveFile struct {
+	timestamp time.Time
+	fpath     string
+	codec     Codec
+}
+
+func (me *Muster) getNewArchives() ([]archiveFile, error) {
+	fpaths, err := listArchiveDirs(me)
 	if err != nil {
 		return nil, fmt.Errorf("error listing timestamps: %w", err)
 	}
@@ -50,69 +73,114 @@ func (me *Muster) getNewTimestamps() ([]time.Time, error) {
 	// Reset the unready timestamp each time
 	me.unreadyTs = FUTURE_TIMESTAMP
 
-	// potentialTimestamps are archive timestamps greater than me.latestTs
-	dirpath := me.dirpath()
-	potentialTimestamps := []time.Time{}
-	for _, f := range files {
-		if f.IsDir() {
-			continue
-		}
-
+	// potentialArchives are archives with timestamps greater than me.latestTs
+	potentialArchives := map[time.Time]archiveFile{}
+	allTimestamps := []time.Time{}
+	for _, fpath := range fpaths {
 		// Check for a currently-compressing file.
-		ts, err := me.fpathToTimestamp(dirpath + f.Name() + compressSuffix)
+		ts, err := me.fpathToTimestamp(fpath + me.compressSuffix())
 		if err == nil {
-			if ts.Before(me.unreadyTs) {
+			if ts.After(me.latestTs) && ts.Before(me.unreadyTs) {
 				me.unreadyTs = ts
 			}
 			continue
 		}
 
-		// Check for a compressed archive
-		ts, err = me.fpathToTimestamp(dirpath + f.Name())
+		// Check for a compressed archive (of any codec)
+		ts, err = me.fpathToTimestamp(fpath)
 		if err != nil {
 			continue
 		}
+		codec, err := fpathToCodec(me, fpath)
+		if err != nil {
+			continue
+		}
+		allTimestamps = append(allTimestamps, ts)
 
 		// Add any timestamp greater than the latest one.
 		// We will filter unready ones later once we know the unready ceiling.
-		if ts.After(me.latestTs) {
-			potentialTimestamps = append(potentialTimestamps, ts)
+		if _, ok := potentialArchives[ts]; !ok && ts.After(me.latestTs) {
+			potentialArchives[ts] = archiveFile{ts, fpath, codec}
+		}
+	}
+
+	// Find each archive's predecessor, which bounds the start of its content
+	sort.Slice(allTimestamps, func(i, j int) bool { return allTimestamps[i].Before(allTimestamps[j]) })
+	prevTimestamps := make(map[time.Time]time.Time, len(allTimestamps))
+	for i, ts := range allTimestamps {
+		if i > 0 && allTimestamps[i-1].Before(ts) {
+			prevTimestamps[ts] = allTimestamps[i-1]
+		} else if i > 0 {
+			prevTimestamps[ts] = prevTimestamps[allTimestamps[i-1]]
 		}
 	}
+	if len(allTimestamps) > 0 {
+		me.newestArchiveTs = allTimestamps[len(allTimestamps)-1]
+	}
 
-	// Reduce to ready timestamps
-	readyTimestamps := make([]time.Time, 0, len(potentialTimestamps))
-	for _, ts := range potentialTimestamps {
-		if ts.Before(me.unreadyTs) {
-			readyTimestamps = append(readyTimestamps, ts)
+	// An archive's timestamp bounds the end of its content, unless timestamps are
+	// coarse. Its content may then be as late as its successor's timestamp, or for
+	// the newest archives, as late as the logfile's.
+	endTimestamps := make(map[time.Time]time.Time, len(allTimestamps))
+	isCoarse := me.isCoarseStamp()
+	for i := len(allTimestamps) - 1; i >= 0; i-- {
+		ts := allTimestamps[i]
+		switch {
+		case !isCoarse:
+			endTimestamps[ts] = ts
+		case i == len(allTimestamps)-1:
+			endTimestamps[ts] = FUTURE_TIMESTAMP
+		case ts.Before(allTimestamps[i+1]):
+			endTimestamps[ts] = allTimestamps[i+1]
+		default:
+			endTimestamps[ts] = endTimestamps[allTimestamps[i+1]]
 		}
 	}
 
-	// Sort ready timestamps in descending order, limited to MaxArchiveLookback()
-	sort.Slice(readyTimestamps, func(i, j int) bool { return readyTimestamps[i].After(readyTimestamps[j]) })
-	if len(readyTimestamps) > me.MaxArchiveLookback() {
-		readyTimestamps = readyTimestamps[:me.MaxArchiveLookback()]
+	// Reduce to ready archives within the window
+	readyArchives := make([]archiveFile, 0, len(potentialArchives))
+	skippedTs := time.Time{}
+	for ts, archive := range potentialArchives {
+		if !ts.Before(me.unreadyTs) {
+			continue
+		}
+		if me.isInWindow(endTimestamps[ts], prevTimestamps[ts]) {
+			readyArchives = append(readyArchives, archive)
+		} else if ts.After(skippedTs) {
+			skippedTs = ts
+		}
+	}
+
+	// Sort ready archives in descending order, limited to MaxArchiveLookback()
+	sort.Slice(readyArchives, func(i, j int) bool { return readyArchives[i].timestamp.After(readyArchives[j].timestamp) })
+	if len(readyArchives) > me.MaxArchiveLookback() {
+		readyArchives = readyArchives[:me.MaxArchiveLookback()]
 	}
 
-	if len(readyTimestamps) > 0 {
-		me.latestTs = readyTimestamps[0]
+	if len(readyArchives) > 0 {
+		me.latestTs = readyArchives[0].timestamp
+	}
+	// Those outside of the window are passed over too. Otherwise, following a
+	// rotation would skip one of them rather than the renamed logfile.
+	if skippedTs.After(me.latestTs) {
+		me.latestTs = skippedTs
 	}
-	return readyTimestamps, nil
+	return readyArchives, nil
 }
 
 func (me *Muster) loadArchives() error {
-	timestamps, err := me.getNewTimestamps()
+	archives, err := me.getNewArchives()
 	if err != nil {
 		return fmt.Errorf("error processing archives: %w", err)
 	}
 
 	// Open all the files in one go from newest to oldest, stopping at
 	// a NotExist error (the file was probably deleted by rotation).
-	me.openArchives = make([]io.Closer, 0, len(timestamps))
-	readers := make([]io.Reader, 0, len(timestamps))
-	for _, ts := range timestamps {
+	me.openArchives = make([]io.Closer, 0, 2*len(archives))
+	readers := make([]io.Reader, 0, len(archives))
+	for _, archive := range archives {
 		// Open the file, adding it to me.openArchives
-		fpath := me.timestampToFpath(ts)
+		fpath := archive.fpath
 		f, err := os.Open(fpath)
 		if err != nil {
 			if errors.Is(err, os.ErrNotExist) {
@@ -124,12 +192,13 @@ func (me *Muster) loadArchives() error {
 		me.openArchives = append(me.openArchives, f)
 
 		// Create a decompression reader to be used in a MultiReader below
-		gzReader, err := gzip.NewReader(f)
+		zReader, err := archive.codec.NewReader(f)
 		if err != nil {
 			f.Close()
 			return fmt.Errorf("error creating decompression reader for %s: %w", fpath, err)
 		}
-		readers = append(readers, gzReader)
+		me.openArchives = append(me.openArchives, zReader)
+		readers = append(readers, zReader)
 	}
 
 	if len(readers) > 0 {
@@ -156,7 +225,113 @@ func (me *Muster) MaxArchiveLookback() int {
 	return int(0.75 * float64(getOpenFilesLimit()))
 }
 
+// oldestArchiveAfter returns the timestamp of the oldest archive (compressed or not) after ts
+func (me *Muster) oldestArchiveAfter(ts time.Time) (time.Time, bool) {
+	fpaths, err := listArchiveDirs(me)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	oldest, found := time.Time{}, false
+	for _, fpath := range fpaths {
+		archiveTs, err := me.fpathToTimestamp(fpath)
+		if err != nil {
+			archiveTs, err = me.fpathToTimestamp(fpath + me.compressSuffix())
+		}
+		if err != nil || !archiveTs.After(ts) {
+			continue
+		}
+		if !found || archiveTs.Before(oldest) {
+			oldest, found = archiveTs, true
+		}
+	}
+	return oldest, found
+}
+
+// isLogfileReplaced reports whether the logfile path now refers to another file
+// than the one open, i.e. it was rotated. A missing logfile is not (yet) replaced.
+func (me *Muster) isLogfileReplaced() bool {
+	openInfo, err := me.lastOpenFile.Stat()
+	if err != nil {
+		return false
+	}
+	pathInfo, err := os.Stat(me.Filepath)
+	if err != nil {
+		return false
+	}
+	return !os.SameFile(openInfo, pathInfo)
+}
+
+// followWait sleeps before checking the logfile again, returning false if closed
+func (me *Muster) followWait() bool {
+	if me.closed.Load() {
+		return false
+	}
+	return me.sleep()
+}
+
+// sleep waits before checking for files again, meanwhile leaving the Muster to be
+// closed by another goroutine. It returns false if it was.
+func (me *Muster) sleep() bool {
+	me.mu.Unlock()
+	time.Sleep(SLEEP_TIME)
+	me.mu.Lock()
+	return !me.closed.Load()
+}
+
+// followRead is called at the end of the logfile in follow mode. It waits for more
+// to be written or for the logfile to be rotated, in which case the renamed file
+// is drained before moving on.
+func (me *Muster) followRead(p []byte) (int, error) {
+	for {
+		// Check for rotation before reading, so that the renamed file is
+		// known to be fully drained once a read of it returns io.EOF.
+		isReplaced := me.isLogfileReplaced()
+
+		n, readErr := me.lastOpenFile.Read(p)
+		if readErr != nil && readErr != io.EOF {
+			return n, fmt.Errorf("error in read: %w", readErr)
+		}
+		if n > 0 {
+			return n, nil
+		}
+
+		if isReplaced {
+			closeErr := me.lastOpenFile.Close()
+			me.lastOpenFile = nil
+			if closeErr != nil {
+				return 0, fmt.Errorf("error in close: %w", closeErr)
+			}
+
+			// The renamed file became the oldest archive after those already read.
+			// Skip it, then continue with any newer archives and the new logfile.
+			if ts, ok := me.oldestArchiveAfter(me.latestTs); ok {
+				me.latestTs = ts
+			}
+			return me.read(p)
+		}
+
+		if !me.followWait() {
+			return me.closeFiles()
+		}
+	}
+}
+
 func (me *Muster) Read(p []byte) (int, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+
+	if me.isLineFiltered() {
+		return me.readLines(p)
+	}
+	return me.read(p)
+}
+
+func (me *Muster) read(p []byte) (int, error) {
+	if me.Follow && me.closed.Load() {
+		return me.closeFiles()
+	}
+
 	for me.lastOpenFile == nil {
 		// Here, me.archiveMultireader is nil in two sitations:
 		//
@@ -205,13 +380,19 @@ func (me *Muster) Read(p []byte) (int, error) {
 		// but there could still be an unready archive. In that case,
 		// we must wait for everything to be ready before proceeding.
 		if me.unreadyTs.Before(FUTURE_TIMESTAMP) {
-			time.Sleep(SLEEP_TIME)
+			if !me.sleep() {
+				return me.closeFiles()
+			}
 			continue
 		}
 
 		// When we make it to here, we have just checked and confirmed that
 		// there are no more unprocessed archives. However, we don't yet
-		// have a read handle on the final (current) logfile.
+		// have a read handle on the final (current) logfile. Its content
+		// was written after the newest archive, which may be past Until.
+		if !me.isInWindow(FUTURE_TIMESTAMP, me.newestArchiveTs) {
+			return 0, io.EOF
+		}
 		f, err := os.Open(me.Filepath)
 		if err != nil {
 			if errors.Is(err, os.ErrNotExist) {
@@ -223,11 +404,19 @@ func (me *Muster) Read(p []byte) (int, error) {
 					continue
 				}
 				if me.unreadyTs.Before(FUTURE_TIMESTAMP) {
-					time.Sleep(SLEEP_TIME)
+					if !me.sleep() {
+						return me.closeFiles()
+					}
 					continue
 				}
 
-				// The logfile is really gone.
+				// The logfile is really gone. When following, wait for it.
+				if me.Follow {
+					if !me.followWait() {
+						return me.closeFiles()
+					}
+					continue
+				}
 			}
 			return 0, fmt.Errorf("error opening %s: %w", me.Filepath, err)
 		}
@@ -241,6 +430,12 @@ func (me *Muster) Read(p []byte) (int, error) {
 	if readErr == nil {
 		return n, nil
 	}
+	if me.Follow && readErr == io.EOF {
+		if n > 0 {
+			return n, nil
+		}
+		return me.followRead(p)
+	}
 	closeErr := me.lastOpenFile.Close()
 
 	if readErr != io.EOF {
@@ -252,8 +447,24 @@ func (me *Muster) Read(p []byte) (int, error) {
 	return n, io.EOF
 }
 
-func (me *Muster) Close() error {
+// closeFiles releases the open files of a closed Muster
+func (me *Muster) closeFiles() (int, error) {
+	me.closeAllOpenArchives()
+	me.openArchives = nil
 	me.archiveMultireader = nil
-	me.lastOpenFile = nil
+	if me.lastOpenFile != nil {
+		me.lastOpenFile.Close()
+		me.lastOpenFile = nil
+	}
+	return 0, io.EOF
+}
+
+// Close releases the open files. When following, it may be called from another
+// goroutine, to end a waiting Read.
+func (me *Muster) Close() error {
+	me.closed.Store(true)
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	me.closeFiles()
 	return nil
 }
@@ -10,6 +10,10 @@ func (me *Muster) dirpath() string {
 	return dirpath(me)
 }
 
+func (me *Muster) archiveDirpath() string {
+	return archiveDirpath(me, me.ArchiveDir)
+}
+
 func (me *Muster) namePrefix() string {
 	return namePrefix(me)
 }
@@ -18,16 +22,20 @@ func (me *Muster) nameExt() string {
 	return nameExt(me)
 }
 
-func (me *Muster) timestampToFpath(ts time.Time) string {
-	return timestampToFpath(me, ts)
+func (me *Muster) compressSuffix() string {
+	return defaultCodec.Suffix()
 }
 
-func (me *Muster) timestampLength() int {
-	return timestampLength(me)
+func (me *Muster) codecs() []Codec {
+	return append(append([]Codec{}, me.Codecs...), builtinCodecs...)
 }
 
-func (me *Muster) parseTimestamp(s string) (time.Time, error) {
-	return parseTimestamp(me, s)
+func (me *Muster) filestamper() Filestamper {
+	return filestamperOrDefault(me.Filestamper)
+}
+
+func (me *Muster) timestampToFpath(ts time.Time) string {
+	return timestampToFpath(me, ts)
 }
 
 func (me *Muster) fpathToTimestamp(fpath string) (time.Time, error) {
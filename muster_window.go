@@ -0,0 +1,98 @@
+package tumble
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"time"
+)
+
+// lineTimeSeparator follows the timestamp at the start of each line written with a time format
+const lineTimeSeparator = " : "
+
+// isInWindow reports whether content written after prevTs and up to ts may fall
+// between Since and Until. This is the content of an archive ending at ts (see
+// getNewArchives) whose predecessor has timestamp prevTs.
+func (me *Muster) isInWindow(ts, prevTs time.Time) bool {
+	if !me.Since.IsZero() && ts.Before(me.Since) {
+		return false
+	}
+	if !me.Until.IsZero() && prevTs.After(me.Until) {
+		return false
+	}
+	return true
+}
+
+// isCoarseStamp reports whether archive timestamps lose any precision (as with a
+// layout such as "2006-01-02", or even whole seconds), so that each is only a
+// lower bound on the time of its rotation
+func (me *Muster) isCoarseStamp() bool {
+	ref := time.Date(2017, 7, 14, 2, 40, 1, 123456789, time.UTC)
+	name := me.filestamper().ArchiveName(logName(me), ref, 0)
+	ts, _, err := me.filestamper().ParseArchiveName(logName(me), name)
+	return err != nil || !ts.Equal(ref)
+}
+
+// isLineFiltered reports whether lines are trimmed to the window by their timestamps
+func (me *Muster) isLineFiltered() bool {
+	return (me.LineTimeFormat != "" || me.LineTimeFn != nil) && (!me.Since.IsZero() || !me.Until.IsZero())
+}
+
+// lineTime parses the timestamp at the start of a line, if it has one
+func (me *Muster) lineTime(line []byte) (time.Time, bool) {
+	if me.LineTimeFn != nil {
+		return me.LineTimeFn(line)
+	}
+	idx := bytes.Index(line, []byte(lineTimeSeparator))
+	if idx < 0 {
+		return time.Time{}, false
+	}
+	ts, err := time.ParseInLocation(me.LineTimeFormat, string(line[:idx]), time.UTC)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return ts, true
+}
+
+// keepLine decides whether a line is within the window. A line without a timestamp
+// (such as the continuation of a multi-line message) follows the line before it.
+// Once a line is after Until, the rest are too, which ends the Muster.
+func (me *Muster) keepLine(line []byte) bool {
+	if len(line) == 0 {
+		return false
+	}
+	ts, ok := me.lineTime(line)
+	if !ok {
+		return me.lineKeep
+	}
+	if !me.Until.IsZero() && ts.After(me.Until) {
+		me.lineErr = io.EOF
+		me.lineKeep = false
+		return false
+	}
+	me.lineKeep = me.Since.IsZero() || !ts.Before(me.Since)
+	return me.lineKeep
+}
+
+// readLines is Read with lines trimmed to the window
+func (me *Muster) readLines(p []byte) (int, error) {
+	if me.lineReader == nil {
+		me.lineReader = bufio.NewReader(readerFunc(me.read))
+		me.lineKeep = true
+	}
+	for len(me.lineBuf) == 0 {
+		if me.lineErr != nil {
+			return 0, me.lineErr
+		}
+		line, err := me.lineReader.ReadBytes('\n')
+		if me.lineErr == nil {
+			me.lineErr = err
+		}
+		if me.keepLine(line) {
+			me.lineBuf = line
+		}
+	}
+	n := copy(p, me.lineBuf)
+	me.lineBuf = me.lineBuf[n:]
+	return n, nil
+}
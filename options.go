@@ -0,0 +1,209 @@
+package tumble
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// ErrInvalidConfig is returned by NewLoggerWithOptions for a Logger which can't work as configured
+var ErrInvalidConfig = errors.New("invalid logger config")
+
+// Option configures a Logger made by NewLoggerWithOptions. Each sets the Logger field of the same name.
+type Option func(me *Logger) error
+
+func WithMaxLogSizeMB(maxLogSizeMB uint64) Option {
+	return func(me *Logger) error { me.MaxLogSizeMB = maxLogSizeMB; return nil }
+}
+
+func WithMaxTotalSizeMB(maxTotalSizeMB uint64) Option {
+	return func(me *Logger) error { me.MaxTotalSizeMB = maxTotalSizeMB; return nil }
+}
+
+func WithFormatFn(formatFn func(msg []byte, buf []byte) ([]byte, int)) Option {
+	return func(me *Logger) error { me.FormatFn = formatFn; return nil }
+}
+
+func WithRotateInterval(interval time.Duration) Option {
+	return func(me *Logger) error { me.RotateInterval = interval; return nil }
+}
+
+func WithCodec(codec Codec) Option {
+	return func(me *Logger) error { me.Codec = codec; return nil }
+}
+
+func WithMaxArchiveAge(age time.Duration) Option {
+	return func(me *Logger) error { me.MaxArchiveAge = age; return nil }
+}
+
+func WithMaxArchives(n int) Option {
+	return func(me *Logger) error { me.MaxArchives = n; return nil }
+}
+
+func WithMinArchiveAge(age time.Duration) Option {
+	return func(me *Logger) error { me.MinArchiveAge = age; return nil }
+}
+
+func WithOnError(onError func(err error)) Option {
+	return func(me *Logger) error { me.OnError = onError; return nil }
+}
+
+func WithOnEvent(onEvent func(event Event)) Option {
+	return func(me *Logger) error { me.OnEvent = onEvent; return nil }
+}
+
+func WithFilestamper(filestamper Filestamper) Option {
+	return func(me *Logger) error { me.Filestamper = filestamper; return nil }
+}
+
+func WithFileLock(fileLock bool) Option {
+	return func(me *Logger) error { me.FileLock = fileLock; return nil }
+}
+
+// WithAsyncQueue sets AsyncQueueBytes and AsyncPolicy
+func WithAsyncQueue(queueBytes int64, policy QueuePolicy) Option {
+	return func(me *Logger) error { me.AsyncQueueBytes, me.AsyncPolicy = queueBytes, policy; return nil }
+}
+
+// WithSync sets SyncPolicy, along with SyncBytes and SyncInterval (which only some policies use)
+func WithSync(policy SyncPolicy, syncBytes int64, interval time.Duration) Option {
+	return func(me *Logger) error {
+		me.SyncPolicy, me.SyncBytes, me.SyncInterval = policy, syncBytes, interval
+		return nil
+	}
+}
+
+func WithRecordDelimiter(delimiter []byte) Option {
+	return func(me *Logger) error { me.RecordDelimiter = delimiter; return nil }
+}
+
+func WithFileMode(mode os.FileMode) Option {
+	return func(me *Logger) error { me.FileMode = mode; return nil }
+}
+
+func WithDirMode(mode os.FileMode) Option {
+	return func(me *Logger) error { me.DirMode = mode; return nil }
+}
+
+// WithOwner sets Uid and Gid. Either may be -1 to leave it unchanged.
+func WithOwner(uid, gid int) Option {
+	return func(me *Logger) error { me.Uid, me.Gid = uid, gid; return nil }
+}
+
+func WithReopenCheckInterval(interval time.Duration) Option {
+	return func(me *Logger) error { me.ReopenCheckInterval = interval; return nil }
+}
+
+// WithMinFree sets MinFreeMB and MinFreePercent. Either may be 0 to not use it.
+func WithMinFree(minFreeMB uint64, minFreePercent float64) Option {
+	return func(me *Logger) error { me.MinFreeMB, me.MinFreePercent = minFreeMB, minFreePercent; return nil }
+}
+
+func WithDiskFullPolicy(policy DiskFullPolicy) Option {
+	return func(me *Logger) error { me.DiskFullPolicy = policy; return nil }
+}
+
+func WithArchiveDir(dir string) Option {
+	return func(me *Logger) error { me.ArchiveDir = dir; return nil }
+}
+
+// WithArchiveSink sets ArchiveSink and SinkBeforeDelete.
+func WithArchiveSink(sink ArchiveSink, sinkBeforeDelete bool) Option {
+	return func(me *Logger) error { me.ArchiveSink, me.SinkBeforeDelete = sink, sinkBeforeDelete; return nil }
+}
+
+// WithOnArchive sets OnArchive, OnArchiveRetries and OnArchiveTimeout. The timeout may be 0 for none.
+func WithOnArchive(fn func(ctx context.Context, archive Archive) error, retries int, timeout time.Duration) Option {
+	return func(me *Logger) error {
+		me.OnArchive, me.OnArchiveRetries, me.OnArchiveTimeout = fn, retries, timeout
+		return nil
+	}
+}
+
+// NewLoggerWithOptions is NewLogger, with its parameters and any other fields set
+// by options. WithMaxLogSizeMB and WithMaxTotalSizeMB are required. Rather than a
+// Logger which can't work as configured, an error wrapping ErrInvalidConfig is
+// returned. For example:
+//
+//	logger, err := tumble.NewLoggerWithOptions("/path/to/foo.log",
+//	    tumble.WithMaxLogSizeMB(100),
+//	    tumble.WithMaxTotalSizeMB(500),
+//	    tumble.WithCodec(tumble.ZstdCodec{}),
+//	)
+func NewLoggerWithOptions(fpath string, opts ...Option) (*Logger, error) {
+	logger := newLogger(fpath, 0, 0, nil)
+	for _, opt := range opts {
+		if err := opt(logger); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+		}
+	}
+	if err := logger.validate(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+	logger.start()
+	return logger, nil
+}
+
+func (me *Logger) validate() error {
+	switch {
+	case me.Filepath == "" || me.Filepath == ".":
+		return errors.New("Filepath is required")
+	case me.MaxLogSizeMB == 0:
+		return errors.New("MaxLogSizeMB is required")
+	case me.MaxTotalSizeMB < me.MaxLogSizeMB:
+		return fmt.Errorf("MaxTotalSizeMB (%d) must be at least MaxLogSizeMB (%d)", me.MaxTotalSizeMB, me.MaxLogSizeMB)
+	case me.RotateInterval < 0:
+		return fmt.Errorf("RotateInterval (%s) must not be negative", me.RotateInterval)
+	case me.MaxArchiveAge < 0:
+		return fmt.Errorf("MaxArchiveAge (%s) must not be negative", me.MaxArchiveAge)
+	case me.MaxArchives < 0:
+		return fmt.Errorf("MaxArchives (%d) must not be negative", me.MaxArchives)
+	case me.MinArchiveAge < 0:
+		return fmt.Errorf("MinArchiveAge (%s) must not be negative", me.MinArchiveAge)
+	case me.AsyncQueueBytes < 0:
+		return fmt.Errorf("AsyncQueueBytes (%d) must not be negative", me.AsyncQueueBytes)
+	case me.AsyncPolicy < QueueBlock || me.AsyncPolicy > QueueDropOldest:
+		return fmt.Errorf("unknown AsyncPolicy %s", me.AsyncPolicy)
+	case me.SyncPolicy < SyncNever || me.SyncPolicy > SyncEveryWrite:
+		return fmt.Errorf("unknown SyncPolicy %s", me.SyncPolicy)
+	case me.SyncPolicy == SyncEveryBytes && me.SyncBytes <= 0:
+		return fmt.Errorf("SyncPolicy %s requires SyncBytes", me.SyncPolicy)
+	case me.SyncPolicy == SyncEveryInterval && me.SyncInterval <= 0:
+		return fmt.Errorf("SyncPolicy %s requires SyncInterval", me.SyncPolicy)
+	case me.RecordDelimiter != nil && len(me.RecordDelimiter) == 0:
+		return errors.New("RecordDelimiter must not be empty")
+	case me.FileMode&^os.ModePerm != 0:
+		return fmt.Errorf("FileMode (%s) must only have permission bits", me.FileMode)
+	case me.DirMode&^os.ModePerm != 0:
+		return fmt.Errorf("DirMode (%s) must only have permission bits", me.DirMode)
+	case me.ReopenCheckInterval < 0:
+		return fmt.Errorf("ReopenCheckInterval (%s) must not be negative", me.ReopenCheckInterval)
+	case me.MinFreePercent < 0 || me.MinFreePercent >= 100:
+		return fmt.Errorf("MinFreePercent (%g) must be from 0 up to 100", me.MinFreePercent)
+	case me.DiskFullPolicy < DiskFullWrite || me.DiskFullPolicy > DiskFullTruncate:
+		return fmt.Errorf("unknown DiskFullPolicy %s", me.DiskFullPolicy)
+	case me.Uid < -1 || me.Gid < -1:
+		return fmt.Errorf("owner (%d:%d) must not be negative, other than -1", me.Uid, me.Gid)
+	case me.ArchiveDir != "" && isFile(me.ArchiveDir):
+		return fmt.Errorf("ArchiveDir (%s) must be a directory", me.ArchiveDir)
+	case me.OnArchiveRetries < 0:
+		return fmt.Errorf("OnArchiveRetries (%d) must not be negative", me.OnArchiveRetries)
+	case me.OnArchiveTimeout < 0:
+		return fmt.Errorf("OnArchiveTimeout (%s) must not be negative", me.OnArchiveTimeout)
+	case me.SinkBeforeDelete && me.ArchiveSink == nil:
+		return errors.New("SinkBeforeDelete requires ArchiveSink")
+	}
+
+	// Otherwise, a bad compression level would only fail in the mill, leaving archives uncompressed
+	if me.Codec != nil {
+		w, err := me.Codec.NewWriter(io.Discard)
+		if err != nil {
+			return fmt.Errorf("Codec can't compress: %w", err)
+		}
+		w.Close()
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package tumble
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// dirCheckInterval is how often a Write checks whether the logfile's directory was removed
+var dirCheckInterval = time.Second
+
+// filePerm is the mode for new logfiles and archives: FileMode, or fileMode if unset
+func (me *Logger) filePerm() os.FileMode {
+	if me.FileMode == 0 {
+		return os.FileMode(fileMode)
+	}
+	return me.FileMode
+}
+
+// makeDir creates the logfile's missing parent directories, if DirMode is set
+func (me *Logger) makeDir() error {
+	if me.DirMode == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(me.Filepath), me.DirMode); err != nil {
+		return fmt.Errorf("can't create log directory: %w", err)
+	}
+	return nil
+}
+
+// archiveDir is the directory for compressed archives: ArchiveDir, or the logfile's
+func (me *Logger) archiveDir() string {
+	if me.archiveDirpath() == "" {
+		return "."
+	}
+	return me.archiveDirpath()
+}
+
+// makeArchiveDir creates ArchiveDir if missing, with DirMode or archiveDirMode if unset
+func (me *Logger) makeArchiveDir() error {
+	if me.archiveDirpath() == me.dirpath() {
+		return nil
+	}
+	mode := me.DirMode
+	if mode == 0 {
+		mode = archiveDirMode
+	}
+	if err := os.MkdirAll(me.archiveDir(), mode); err != nil {
+		return fmt.Errorf("can't create archive directory: %w", err)
+	}
+	return nil
+}
+
+// isFile reports whether path exists, other than as a directory
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+// isDirRemoved reports whether the logfile's directory has been removed since it was
+// opened, and can be created again (as DirMode is set). This is checked at most once
+// per dirCheckInterval. This must be called with me.mu held.
+func (me *Logger) isDirRemoved() bool {
+	if me.DirMode == 0 {
+		return false
+	}
+	now := nowFn()
+	if now.Before(me.dirCheckAt) {
+		return false
+	}
+	me.dirCheckAt = now.Add(dirCheckInterval)
+
+	_, err := os.Stat(filepath.Dir(me.Filepath))
+	return errors.Is(err, os.ErrNotExist)
+}
+
+// setPerm gives a file we created its owner, and FileMode (exactly, regardless of the
+// umask) if set. Otherwise, the file is given mode, unless 0 (leaving it as created).
+func (me *Logger) setPerm(f *os.File, mode os.FileMode) error {
+	if me.FileMode != 0 {
+		mode = me.FileMode
+	}
+	if mode != 0 {
+		if err := f.Chmod(mode); err != nil {
+			return fmt.Errorf("can't chmod %s: %w", f.Name(), err)
+		}
+	}
+	if me.Uid == -1 && me.Gid == -1 {
+		return nil
+	}
+	if err := f.Chown(me.Uid, me.Gid); err != nil {
+		return fmt.Errorf("can't chown %s: %w", f.Name(), err)
+	}
+	return nil
+}
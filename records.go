@@ -0,0 +1,50 @@
+package tumble
+
+import "bytes"
+
+// writeRecords buffers p, and writes out each record it completes as a whole,
+// so that a rotation only ever falls between records. What follows the last
+// delimiter is kept until it is completed by a later Write, or until Close,
+// unless it reaches MaxLogSizeMB. It is then written out as a record, as it
+// could never fit in a logfile whole. This must be called with me.mu held.
+func (me *Logger) writeRecords(p []byte) (int, error) {
+	me.partial = append(me.partial, p...)
+
+	// Should a write fail, the unwritten records are kept to be retried
+	start := 0
+	var err error
+	for err == nil {
+		idx := bytes.Index(me.partial[start:], me.RecordDelimiter)
+		if idx < 0 {
+			break
+		}
+		var n int
+		n, err = me.writeFile(me.partial[start : start+idx+len(me.RecordDelimiter)])
+		start += n
+	}
+	if err == nil && uint64(len(me.partial)-start) >= me.MaxLogSizeMB*MB {
+		var n int
+		n, err = me.writeFile(me.partial[start:])
+		start += n
+	}
+	me.partial = me.partial[:copy(me.partial, me.partial[start:])]
+	return len(p), err
+}
+
+// writePartial writes out a partial trailing record, as at Close.
+// This must be called with me.mu held.
+func (me *Logger) writePartial() error {
+	if len(me.partial) == 0 {
+		return nil
+	}
+
+	unlock, err := me.lockFile()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	_, err = me.writeFile(me.partial)
+	me.partial = nil
+	return err
+}
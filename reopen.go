@@ -0,0 +1,42 @@
+package tumble
+
+import (
+	"errors"
+	"os"
+)
+
+// checkReplaced reopens the logfile if Filepath no longer refers to the open file,
+// i.e. it was removed or replaced by another program. This is checked at most once
+// per ReopenCheckInterval. This must be called with me.mu held.
+func (me *Logger) checkReplaced(writeLen int) error {
+	if me.ReopenCheckInterval <= 0 || me.file == nil {
+		return nil
+	}
+	now := nowFn()
+	if now.Before(me.reopenCheckAt) {
+		return nil
+	}
+	me.reopenCheckAt = now.Add(me.ReopenCheckInterval)
+
+	f, ok := me.file.(*os.File)
+	if !ok {
+		return nil
+	}
+	openInfo, err := f.Stat()
+	if err != nil {
+		return nil
+	}
+	pathInfo, err := os.Stat(me.Filepath)
+	if err == nil && os.SameFile(openInfo, pathInfo) {
+		return nil
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	me.emit(Event{Kind: EventReopen, Path: me.Filepath, Size: me.size})
+	if err := me.closeFile(); err != nil {
+		return err
+	}
+	return me.openExistingOrNew(writeLen)
+}
@@ -4,48 +4,106 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 )
 
-func backupName(fpath string) string {
-	dir := filepath.Dir(fpath)
-	filename := filepath.Base(fpath)
-	ext := filepath.Ext(filename)
-	prefix := filename[:len(filename)-len(ext)]
-	t := nowFn().UTC()
-	return filepath.Join(dir, fmt.Sprintf("%s-%d%s", prefix, t.Unix(), ext))
+// backupName returns a path for the logfile to be renamed to, which must not
+// clobber an existing archive (either compressed or uncompressed). Should the
+// name for the current time be taken, the next seq is tried.
+func (me *Logger) backupName() (string, error) {
+	ts := nowFn()
+	prev := ""
+	for seq := 0; ; seq++ {
+		name := timestampToBasepath(me, ts, seq)
+		if name == prev {
+			return "", fmt.Errorf("archive name %s is taken", name)
+		}
+		if !me.isArchiveTaken(name) {
+			return name, nil
+		}
+		prev = name
+	}
+}
+
+func (me *Logger) isArchiveTaken(name string) bool {
+	if _, err := os.Lstat(name); err == nil {
+		return true
+	}
+	for _, codec := range me.codecs() {
+		if _, err := os.Lstat(name + codec.Suffix()); err == nil {
+			return true
+		}
+		if _, err := os.Lstat(me.archiveDirpath() + filepath.Base(name) + codec.Suffix()); err == nil {
+			return true
+		}
+	}
+	return false
 }
 
 func (me *Logger) renameFile() error {
 	name := me.Filepath
-	_, err := os.Stat(name)
+	info, err := os.Stat(name)
 	if err == nil {
-		newname := backupName(name)
+		newname, err := me.backupName()
+		if err != nil {
+			return fmt.Errorf("can't rename log file: %w", err)
+		}
 		if err := os.Rename(name, newname); err != nil {
 			return fmt.Errorf("can't rename log file: %w", err)
 		}
+		me.emit(Event{Kind: EventRotateFinish, Path: newname, Size: info.Size()})
 	}
 	return nil
 }
 
 func (me *Logger) openNew() error {
 	if err := me.renameFile(); err != nil {
-		return fmt.Errorf("can't open new logfile: %w", err)
+		err = fmt.Errorf("can't open new logfile: %w", err)
+		me.emit(Event{Kind: EventOpenError, Path: me.Filepath, Err: err})
+		return err
+	}
+
+	if err := me.makeDir(); err != nil {
+		err = fmt.Errorf("can't open new logfile: %w", err)
+		me.emit(Event{Kind: EventOpenError, Path: me.Filepath, Err: err})
+		return err
 	}
 
 	// we use truncate here because this should only get called when we've moved
 	// the file ourselves. if someone else creates the file in the meantime,
-	// just wipe out the contents.
-	f, err := os.OpenFile(me.Filepath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(fileMode))
+	// just wipe out the contents. we append so that writes from other processes
+	// sharing the logfile (with FileLock) are not overwritten.
+	f, err := os.OpenFile(me.Filepath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC|os.O_APPEND, me.filePerm())
+	if err == nil {
+		if err = me.setPerm(f, 0); err != nil {
+			f.Close()
+		}
+	}
 	if err != nil {
-		return fmt.Errorf("can't open new logfile: %w", err)
+		err = fmt.Errorf("can't open new logfile: %w", err)
+		me.emit(Event{Kind: EventOpenError, Path: me.Filepath, Err: err})
+		return err
 	}
 	me.file = f
 	me.size = 0
+	me.unsynced = 0
+	me.reopenCheckAt = nowFn().Add(me.ReopenCheckInterval)
+	me.dirCheckAt = nowFn().Add(dirCheckInterval)
+	if me.RotateInterval > 0 {
+		me.rotateAt = nextRotation(nowFn(), me.RotateInterval)
+	}
+
+	// The rename (if any) and the new logfile are only durable once the directory is synced
+	if me.isSync() {
+		return syncDir(filepath.Dir(me.Filepath))
+	}
 	return nil
 }
 
 func (me *Logger) openExistingOrNew(writeLen int) error {
 	me.mill()
+	me.startRotateTimer()
+	me.startSyncTimer()
 
 	fpath := me.Filepath
 	info, err := os.Stat(fpath)
@@ -53,14 +111,23 @@ func (me *Logger) openExistingOrNew(writeLen int) error {
 		return me.openNew()
 	}
 	if err != nil {
-		return fmt.Errorf("error getting log file info: %w", err)
+		err = fmt.Errorf("error getting log file info: %w", err)
+		me.emit(Event{Kind: EventOpenError, Path: fpath, Err: err})
+		return err
 	}
 
 	if info.Size()+int64(writeLen) >= int64(me.MaxLogSizeMB*MB) {
 		return me.rotate()
 	}
 
-	file, err := os.OpenFile(fpath, os.O_APPEND|os.O_WRONLY, fileMode)
+	// The logfile was last written in an earlier interval. Roll it over now.
+	if me.RotateInterval > 0 && info.Size() > 0 {
+		if !nowFn().Before(nextRotation(info.ModTime(), me.RotateInterval)) {
+			return me.rotate()
+		}
+	}
+
+	file, err := os.OpenFile(fpath, os.O_APPEND|os.O_WRONLY, me.filePerm())
 	if err != nil {
 		// if we fail to open the old log file for some reason, just ignore
 		// it and open a new log file.
@@ -68,10 +135,17 @@ func (me *Logger) openExistingOrNew(writeLen int) error {
 	}
 	me.file = file
 	me.size = info.Size()
+	me.unsynced = 0
+	me.reopenCheckAt = nowFn().Add(me.ReopenCheckInterval)
+	me.dirCheckAt = nowFn().Add(dirCheckInterval)
+	if me.RotateInterval > 0 {
+		me.rotateAt = nextRotation(info.ModTime(), me.RotateInterval)
+	}
 	return nil
 }
 
 func (me *Logger) rotate() error {
+	me.emit(Event{Kind: EventRotateStart, Path: me.Filepath, Size: me.size})
 	if err := me.closeFile(); err != nil {
 		return err
 	}
@@ -81,3 +155,89 @@ func (me *Logger) rotate() error {
 	me.mill()
 	return nil
 }
+
+// rotateLocked rotates while holding the inter-process lock (if FileLock is set).
+// Should another process have rotated the logfile first, this is skipped.
+func (me *Logger) rotateLocked() error {
+	unlock, err := me.lockFile()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if me.file == nil || !me.isRotateDue() {
+		return nil
+	}
+	return me.rotate()
+}
+
+// nextRotation returns the first interval boundary after t. Boundaries are
+// multiples of interval since the zero time, which aligns them to UTC.
+func nextRotation(t time.Time, interval time.Duration) time.Time {
+	return t.Truncate(interval).Add(interval)
+}
+
+// isRotateDue reports whether RotateInterval has elapsed for the current logfile.
+// An empty logfile is not rotated. Its deadline just moves to the next boundary.
+func (me *Logger) isRotateDue() bool {
+	if me.RotateInterval <= 0 {
+		return false
+	}
+	now := nowFn()
+	if now.Before(me.rotateAt) {
+		return false
+	}
+	if me.size == 0 {
+		me.rotateAt = nextRotation(now, me.RotateInterval)
+		return false
+	}
+	return true
+}
+
+func (me *Logger) startRotateTimer() {
+	if me.RotateInterval <= 0 {
+		return
+	}
+	me.timerStartOnce.Do(func() {
+		me.timerWG.Add(1)
+		go me.rotateTimerRun()
+	})
+}
+
+func (me *Logger) stopRotateTimer() {
+	me.timerStopOnce.Do(func() {
+		close(me.timerStopCh)
+	})
+	me.timerWG.Wait()
+}
+
+// rotateTimerRun rotates idle logfiles once their interval has elapsed.
+func (me *Logger) rotateTimerRun() {
+	defer me.timerWG.Done()
+
+	for {
+		me.mu.Lock()
+		wait := me.rotateAt.Sub(nowFn())
+		me.mu.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-me.timerStopCh:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		me.mu.Lock()
+		if me.file != nil && me.isRotateDue() {
+			if err := me.rotateLocked(); err != nil {
+				me.reportError(fmt.Errorf("error in tumble/rotateTimerRun: %w", err))
+			}
+		}
+		if !nowFn().Before(me.rotateAt) {
+			// Nothing reset the deadline (e.g. the logfile is closed or failed to open).
+			// Try again at the next boundary rather than spinning.
+			me.rotateAt = nextRotation(nowFn(), me.RotateInterval)
+		}
+		me.mu.Unlock()
+	}
+}
@@ -0,0 +1,207 @@
+package tumble
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Sink uploads archives to a bucket of an S3-compatible API, with a PUT of each
+// to the key Prefix+name, signed with AWS Signature Version 4. Buckets are
+// addressed by path (as "Endpoint/Bucket/key"), which all such APIs support.
+//
+// Endpoint is e.g. "https://s3.us-east-1.amazonaws.com". SessionToken is only
+// needed for temporary credentials. Client is http.DefaultClient if nil.
+type S3Sink struct {
+	Endpoint        string
+	Region          string
+	Bucket          string
+	Prefix          string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Client          *http.Client
+}
+
+func (me S3Sink) Put(ctx context.Context, name string, ts time.Time, r io.Reader) error {
+	if me.Endpoint == "" || me.Bucket == "" {
+		return errors.New("S3Sink requires Endpoint and Bucket")
+	}
+
+	body, size, payloadHash, err := s3Payload(r)
+	if err != nil {
+		return fmt.Errorf("can't read archive: %w", err)
+	}
+	url := strings.TrimSuffix(me.Endpoint, "/") + "/" + s3Escape(me.Bucket, false) + "/" + s3Escape(me.Prefix+name, true)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, url, body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	if me.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", me.SessionToken)
+	}
+	me.signer().sign(req, payloadHash, nowFn())
+
+	client := me.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("S3 PUT %s: %s: %s", req.URL.Path, resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+func (me S3Sink) signer() sigV4 {
+	return sigV4{me.AccessKeyID, me.SecretAccessKey, me.Region, "s3"}
+}
+
+// s3Payload returns a body for r, its length (which S3 requires) and its hash.
+// An archive file is read twice rather than held in memory.
+func s3Payload(r io.Reader) (io.Reader, int64, string, error) {
+	hash := sha256.New()
+	file, ok := r.(interface {
+		io.ReaderAt
+		io.Seeker
+	})
+	if !ok {
+		buf := new(bytes.Buffer)
+		if _, err := io.Copy(io.MultiWriter(buf, hash), r); err != nil {
+			return nil, 0, "", err
+		}
+		return buf, int64(buf.Len()), hex.EncodeToString(hash.Sum(nil)), nil
+	}
+
+	start, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	size, err := io.Copy(hash, r)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	return io.NewSectionReader(file, start, size), size, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// s3Escape URI-encodes s as S3 expects, leaving only unreserved characters (and,
+// for a key, "/") as they are
+func s3Escape(s string, isKey bool) string {
+	var sb strings.Builder
+	for _, b := range []byte(s) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9',
+			b == '-', b == '_', b == '.', b == '~', isKey && b == '/':
+			sb.WriteByte(b)
+		default:
+			fmt.Fprintf(&sb, "%%%02X", b)
+		}
+	}
+	return sb.String()
+}
+
+// sigV4 signs requests with AWS Signature Version 4
+type sigV4 struct {
+	accessKeyID     string
+	secretAccessKey string
+	region          string
+	service         string
+}
+
+const sigV4Algorithm = "AWS4-HMAC-SHA256"
+const sigV4TimeFormat = "20060102T150405Z"
+
+// sign adds the X-Amz-Date, X-Amz-Content-Sha256 and Authorization headers to req.
+// Every header already set on req is signed, along with Host.
+func (me sigV4) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.UTC().Format(sigV4TimeFormat)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := []string{"host"}
+	for key := range req.Header {
+		signedHeaders = append(signedHeaders, strings.ToLower(key))
+	}
+	sort.Strings(signedHeaders)
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s,SignedHeaders=%s,Signature=%s",
+		sigV4Algorithm, me.accessKeyID, me.scope(amzDate), strings.Join(signedHeaders, ";"),
+		me.signature(req, signedHeaders, payloadHash, amzDate)))
+}
+
+// scope is as "20130524/us-east-1/s3/aws4_request"
+func (me sigV4) scope(amzDate string) string {
+	return amzDate[:8] + "/" + me.region + "/" + me.service + "/aws4_request"
+}
+
+// signature computes the signature of req over signedHeaders (in lower case, and sorted)
+func (me sigV4) signature(req *http.Request, signedHeaders []string, payloadHash, amzDate string) string {
+	var canonical strings.Builder
+	canonical.WriteString(req.Method + "\n")
+	canonical.WriteString(req.URL.EscapedPath() + "\n")
+	canonical.WriteString(sigV4Query(req) + "\n")
+	for _, key := range signedHeaders {
+		value := req.Header.Get(key)
+		if key == "host" {
+			value = req.Host
+			if value == "" {
+				value = req.URL.Host
+			}
+		}
+		canonical.WriteString(key + ":" + strings.Join(strings.Fields(value), " ") + "\n")
+	}
+	canonical.WriteString("\n" + strings.Join(signedHeaders, ";") + "\n")
+	canonical.WriteString(payloadHash)
+
+	stringToSign := strings.Join([]string{
+		sigV4Algorithm,
+		amzDate,
+		me.scope(amzDate),
+		hex.EncodeToString(sha256Sum([]byte(canonical.String()))),
+	}, "\n")
+
+	key := hmacSum([]byte("AWS4"+me.secretAccessKey), amzDate[:8])
+	key = hmacSum(key, me.region)
+	key = hmacSum(key, me.service)
+	key = hmacSum(key, "aws4_request")
+	return hex.EncodeToString(hmacSum(key, stringToSign))
+}
+
+// sigV4Query is the canonical query string of req, with parameters sorted and encoded
+func sigV4Query(req *http.Request) string {
+	params := []string{}
+	for key, values := range req.URL.Query() {
+		for _, value := range values {
+			params = append(params, s3Escape(key, false)+"="+s3Escape(value, false))
+		}
+	}
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
+
+func sha256Sum(p []byte) []byte {
+	sum := sha256.Sum256(p)
+	return sum[:]
+}
+
+func hmacSum(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,97 @@
+package tumble
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ArchiveSink receives each archive once it is compressed, e.g. to ship it to
+// object storage. The name is that of the archive, without its directory (e.g.
+// "foo-1699999999.log.gz"), and ts is its timestamp. Put returns nil once the
+// archive is stored, which acknowledges it.
+//
+// Put may be called more than once for an archive (e.g. after a restart), so
+// storing it again must be harmless. It should return once ctx is done.
+type ArchiveSink interface {
+	Put(ctx context.Context, name string, ts time.Time, r io.Reader) error
+}
+
+var _ ArchiveSink = LocalSink{} // Implement ArchiveSink
+var _ ArchiveSink = S3Sink{}    // Implement ArchiveSink
+
+// LocalSink copies archives into Dir, which must exist, and may be on another filesystem.
+// Each is synced before Put returns.
+type LocalSink struct {
+	Dir string
+}
+
+func (me LocalSink) Put(ctx context.Context, name string, ts time.Time, r io.Reader) (err error) {
+	// We copy into a temporary file which is renamed into place once complete,
+	// so that a partial copy is never seen
+	f, err := os.CreateTemp(me.Dir, name+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("can't create archive copy: %w", err)
+	}
+	defer func() {
+		f.Close()
+		if err != nil {
+			os.Remove(f.Name())
+		}
+	}()
+
+	if _, err := io.Copy(f, contextReader{ctx, r}); err != nil {
+		return fmt.Errorf("can't copy archive: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("can't sync archive copy: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("can't close archive copy: %w", err)
+	}
+	if err := os.Rename(f.Name(), filepath.Join(me.Dir, name)); err != nil {
+		return fmt.Errorf("can't rename archive copy: %w", err)
+	}
+	return syncDir(me.Dir)
+}
+
+// contextReader stops reading once ctx is done
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (me contextReader) Read(p []byte) (int, error) {
+	if err := me.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return me.r.Read(p)
+}
+
+// isArchiveHooked reports whether archives are passed to OnArchive and/or ArchiveSink
+func (me *Logger) isArchiveHooked() bool {
+	return me.OnArchive != nil || me.ArchiveSink != nil
+}
+
+// isHeld reports whether retention must keep the archive at fpath, as it is pending
+// OnArchive, or pending ArchiveSink with SinkBeforeDelete set
+func (me *Logger) isHeld(fpath string) bool {
+	return (me.OnArchive != nil || me.SinkBeforeDelete) && me.isPending(fpath)
+}
+
+// putArchive passes the archive to ArchiveSink
+func (me *Logger) putArchive(ctx context.Context, archive Archive) error {
+	f, err := os.Open(archive.Path)
+	if err != nil {
+		return fmt.Errorf("can't open archive: %w", err)
+	}
+	defer f.Close()
+
+	if err := me.ArchiveSink.Put(ctx, filepath.Base(archive.Path), archive.Timestamp, f); err != nil {
+		return fmt.Errorf("ArchiveSink failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package tumble
+
+import (
+	"bytes"
+	"log/slog"
+	"time"
+)
+
+// NewJSONHandler returns a slog.Handler which writes records to logger as JSON,
+// one per line (see slog.NewJSONHandler). Each record is a single Write, which
+// the Logger never splits across a rotation, so a record is always whole in one
+// file. The logger's FormatFn should be nil so that lines are valid JSON.
+//
+// Set SlogLineTime as the Muster's LineTimeFn to read its records by time.
+func NewJSONHandler(logger *Logger, opts *slog.HandlerOptions) slog.Handler {
+	return slog.NewJSONHandler(logger, opts)
+}
+
+// NewTextHandler is NewJSONHandler, with records written as key=value pairs
+// (see slog.NewTextHandler).
+func NewTextHandler(logger *Logger, opts *slog.HandlerOptions) slog.Handler {
+	return slog.NewTextHandler(logger, opts)
+}
+
+// SlogLineTime returns the time of a record written by NewJSONHandler or
+// NewTextHandler. This is its first attribute, unless removed by ReplaceAttr.
+func SlogLineTime(line []byte) (time.Time, bool) {
+	var value []byte
+	if rest, ok := bytes.CutPrefix(line, []byte(`{"`+slog.TimeKey+`":"`)); ok {
+		value, _, ok = bytes.Cut(rest, []byte(`"`))
+		if !ok {
+			return time.Time{}, false
+		}
+	} else if rest, ok := bytes.CutPrefix(line, []byte(slog.TimeKey+"=")); ok {
+		value, _, _ = bytes.Cut(rest, []byte(" "))
+	} else {
+		return time.Time{}, false
+	}
+
+	ts, err := time.Parse(time.RFC3339Nano, string(value))
+	if err != nil {
+		return time.Time{}, false
+	}
+	return ts, true
+}
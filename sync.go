@@ -0,0 +1,138 @@
+package tumble
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// SyncPolicy decides when the Logger fsyncs the logfile and its directory.
+// Each policy also includes those before it, other than SyncNever.
+type SyncPolicy int
+
+const (
+	SyncNever         SyncPolicy = iota // Leave it to the OS
+	SyncOnRotate                        // Sync the logfile before it is closed, and the directory after rotation
+	SyncEveryBytes                      // Also sync after every SyncBytes written
+	SyncEveryInterval                   // Also sync every SyncInterval, by a background timer
+	SyncEveryWrite                      // Also sync after every Write
+)
+
+func (me SyncPolicy) String() string {
+	switch me {
+	case SyncNever:
+		return "never"
+	case SyncOnRotate:
+		return "rotate"
+	case SyncEveryBytes:
+		return "bytes"
+	case SyncEveryInterval:
+		return "interval"
+	case SyncEveryWrite:
+		return "write"
+	}
+	return fmt.Sprintf("SyncPolicy(%d)", int(me))
+}
+
+// isSync reports whether the logfile and its directory should be synced at all
+func (me *Logger) isSync() bool {
+	return me.SyncPolicy != SyncNever
+}
+
+// Sync writes out any queued writes, and then fsyncs the logfile and its
+// directory, regardless of SyncPolicy.
+func (me *Logger) Sync() error {
+	me.drainAsync()
+	me.mu.Lock()
+	defer me.mu.Unlock()
+
+	if me.closed {
+		return os.ErrClosed
+	}
+	if err := me.syncFile(); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(me.Filepath))
+}
+
+// syncFile flushes and fsyncs the logfile, if open
+func (me *Logger) syncFile() error {
+	if me.file == nil {
+		return nil
+	}
+	if err := me.flush(); err != nil {
+		return err
+	}
+	me.unsynced = 0
+	if f, ok := me.file.(interface{ Sync() error }); ok {
+		if err := f.Sync(); err != nil {
+			return fmt.Errorf("can't sync log file: %w", err)
+		}
+	}
+	return nil
+}
+
+// syncAfterWrite syncs the logfile if SyncPolicy calls for it after a write of n bytes
+func (me *Logger) syncAfterWrite(n int) error {
+	me.unsynced += int64(n)
+	switch {
+	case me.SyncPolicy >= SyncEveryWrite:
+		return me.syncFile()
+	case me.SyncPolicy >= SyncEveryBytes && me.SyncBytes > 0 && me.unsynced >= me.SyncBytes:
+		return me.syncFile()
+	}
+	return nil
+}
+
+// syncDir fsyncs a directory, so that renames and new files in it are durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("can't sync directory: %w", err)
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("can't sync directory: %w", err)
+	}
+	return nil
+}
+
+func (me *Logger) startSyncTimer() {
+	if me.SyncPolicy < SyncEveryInterval || me.SyncInterval <= 0 {
+		return
+	}
+	me.syncStartOnce.Do(func() {
+		me.syncWG.Add(1)
+		go me.syncTimerRun()
+	})
+}
+
+func (me *Logger) stopSyncTimer() {
+	me.syncStopOnce.Do(func() {
+		close(me.syncStopCh)
+	})
+	me.syncWG.Wait()
+}
+
+func (me *Logger) syncTimerRun() {
+	defer me.syncWG.Done()
+
+	ticker := time.NewTicker(me.SyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-me.syncStopCh:
+			return
+		case <-ticker.C:
+		}
+
+		me.mu.Lock()
+		if me.unsynced > 0 {
+			if err := me.syncFile(); err != nil {
+				me.reportError(fmt.Errorf("error in tumble/syncTimerRun: %w", err))
+			}
+		}
+		me.mu.Unlock()
+	}
+}
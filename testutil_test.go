@@ -1,12 +1,18 @@
 package tumble
 
 import (
+	"encoding/hex"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"reflect"
 	"runtime"
+	"strings"
+	"sync"
 	"syscall"
 	"testing"
 	"time"
@@ -29,13 +35,19 @@ func setOpenFilesLimit(n uint64) {
 	}
 }
 
-// Mock the current time and provide a way to advance it manually
+// Mock the current time and provide a way to advance it manually.
+// It is read by the mill goroutine, so guard it for the race detector.
 var fakeCurrentTime = time.Now().UTC()
+var fakeCurrentTimeMu sync.Mutex
 
 func fakeTime() time.Time {
+	fakeCurrentTimeMu.Lock()
+	defer fakeCurrentTimeMu.Unlock()
 	return fakeCurrentTime
 }
 func newFakeTime() {
+	fakeCurrentTimeMu.Lock()
+	defer fakeCurrentTimeMu.Unlock()
 	fakeCurrentTime = fakeCurrentTime.Add(time.Hour * 24 * 2)
 }
 
@@ -65,7 +77,7 @@ func logFile(dir string) string {
 }
 
 func backupFile(dir string) string {
-	fname := fmt.Sprintf("foobar-%d.log", fakeTime().Unix())
+	fname := TimestampFormat{}.ArchiveName("foobar.log", fakeTime(), 0)
 	return filepath.Join(dir, fname)
 }
 
@@ -86,6 +98,71 @@ func exists(path string, t testing.TB) {
 	assertUp(err == nil, t, 1, "expected file to exist, but got error from os.Stat: %v", err)
 }
 
+// fakeS3 is an in-process S3-compatible API, which stores objects PUT with a valid signature (unless failing).
+type fakeS3 struct {
+	*httptest.Server
+	signer  sigV4
+	mu      sync.Mutex
+	objects map[string][]byte
+	failing bool
+}
+
+func newFakeS3(accessKeyID, secretAccessKey, region string) *fakeS3 {
+	me := &fakeS3{signer: sigV4{accessKeyID, secretAccessKey, region, "s3"}, objects: map[string][]byte{}}
+	me.Server = httptest.NewServer(http.HandlerFunc(me.serve))
+	return me
+}
+
+func (me *fakeS3) serve(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "MethodNotAllowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "IncompleteBody", http.StatusBadRequest)
+		return
+	}
+	payloadHash := r.Header.Get("X-Amz-Content-Sha256")
+	if payloadHash != hex.EncodeToString(sha256Sum(body)) {
+		http.Error(w, "XAmzContentSHA256Mismatch", http.StatusBadRequest)
+		return
+	}
+
+	fields := map[string]string{}
+	for _, field := range strings.Split(strings.TrimPrefix(r.Header.Get("Authorization"), sigV4Algorithm+" "), ",") {
+		key, value, _ := strings.Cut(field, "=")
+		fields[key] = value
+	}
+	amzDate := r.Header.Get("X-Amz-Date")
+	signature := me.signer.signature(r, strings.Split(fields["SignedHeaders"], ";"), payloadHash, amzDate)
+	if fields["Credential"] != me.signer.accessKeyID+"/"+me.signer.scope(amzDate) || fields["Signature"] != signature {
+		http.Error(w, "SignatureDoesNotMatch", http.StatusForbidden)
+		return
+	}
+
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	if me.failing {
+		http.Error(w, "ServiceUnavailable", http.StatusServiceUnavailable)
+		return
+	}
+	me.objects[r.URL.Path] = body
+}
+
+func (me *fakeS3) setFailing(failing bool) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	me.failing = failing
+}
+
+func (me *fakeS3) object(path string) ([]byte, bool) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	body, ok := me.objects[path]
+	return body, ok
+}
+
 // assert will log the given message if condition is false.
 func assert(condition bool, t testing.TB, msg string, v ...interface{}) {
 	assertUp(condition, t, 1, msg, v...)
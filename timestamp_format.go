@@ -0,0 +1,138 @@
+package tumble
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TimestampFormat is the built-in Filestamper. It describes how an archive's
+// timestamp appears in its filename, between the logfile's name and extension.
+// The zero value is the default:
+//
+//	foo-1699999999.log.gz              (whole seconds since epoch)
+//	foo-1699999999.123456789.log.gz    (with nanoseconds when non-zero)
+//
+// Separator is placed before the timestamp and defaults to "-".
+//
+// Layout is a time.Format layout (in UTC) to use instead of seconds since epoch.
+// Archives which land on the same formatted time are told apart (and ordered)
+// by the sequence number (seq) following a ".". If SeqDigits is set, it is
+// always present and zero-padded to this width. Otherwise, it is omitted for
+// the first archive. For example:
+//
+//	TimestampFormat{"-", "2006-01-02T15-04-05Z", 0} -> foo-2026-10-16T13-04-05Z.log.gz
+//	                                                   foo-2026-10-16T13-04-05Z.1.log.gz
+//	TimestampFormat{".", "2006-01-02", 3}           -> foo.2026-10-16.000.log.gz
+//	                                                   foo.2026-10-16.001.log.gz
+//
+// Without a Layout, there is no sequence number. Instead, seq is added to the
+// timestamp as nanoseconds.
+type TimestampFormat struct {
+	Separator string
+	Layout    string
+	SeqDigits int
+}
+
+func (me TimestampFormat) separator() string {
+	if me.Separator == "" {
+		return "-"
+	}
+	return me.Separator
+}
+
+// ArchiveName implements Filestamper
+func (me TimestampFormat) ArchiveName(logName string, ts time.Time, seq int) string {
+	ext := filepath.Ext(logName)
+	return logName[:len(logName)-len(ext)] + me.separator() + me.format(ts, seq) + ext
+}
+
+// ParseArchiveName implements Filestamper
+func (me TimestampFormat) ParseArchiveName(logName, archiveName string) (time.Time, int, error) {
+	ext := filepath.Ext(logName)
+	prefix := logName[:len(logName)-len(ext)] + me.separator()
+	if len(archiveName) < len(prefix)+len(ext) || !strings.HasPrefix(archiveName, prefix) || !strings.HasSuffix(archiveName, ext) {
+		return time.Time{}, 0, errors.New("mismatch")
+	}
+	return me.parse(archiveName[len(prefix) : len(archiveName)-len(ext)])
+}
+
+func (me TimestampFormat) format(ts time.Time, seq int) string {
+	ts = ts.UTC()
+	if me.Layout == "" {
+		ts = ts.Add(time.Duration(seq))
+		if ts.Nanosecond() == 0 {
+			return fmt.Sprintf("%d", ts.Unix())
+		}
+		return fmt.Sprintf("%d.%09d", ts.Unix(), ts.Nanosecond())
+	}
+
+	if me.SeqDigits > 0 {
+		return fmt.Sprintf("%s.%0*d", ts.Format(me.Layout), me.SeqDigits, seq)
+	}
+	if seq > 0 {
+		return fmt.Sprintf("%s.%d", ts.Format(me.Layout), seq)
+	}
+	return ts.Format(me.Layout)
+}
+
+func (me TimestampFormat) parse(s string) (time.Time, int, error) {
+	if me.Layout == "" {
+		ts, err := parseUnixTimestamp(s)
+		return ts, 0, err
+	}
+
+	// Without a sequence number, s is just the formatted time. (This must be checked
+	// by formatting, since parsing accepts fractional seconds the layout lacks.)
+	if me.SeqDigits == 0 {
+		if ts, err := time.ParseInLocation(me.Layout, s, time.UTC); err == nil && ts.Format(me.Layout) == s {
+			return ts, 0, nil
+		}
+	}
+
+	idx := strings.LastIndex(s, ".")
+	if idx < 0 {
+		return time.Time{}, 0, errors.New("invalid timestamp")
+	}
+	seqStr := s[idx+1:]
+	if len(seqStr) == 0 || len(seqStr) < me.SeqDigits {
+		return time.Time{}, 0, errors.New("invalid timestamp")
+	}
+	seq, err := strconv.ParseUint(seqStr, 10, 30)
+	if err != nil {
+		return time.Time{}, 0, errors.New("invalid timestamp")
+	}
+	ts, err := time.ParseInLocation(me.Layout, s[:idx], time.UTC)
+	if err != nil {
+		return time.Time{}, 0, errors.New("invalid timestamp")
+	}
+	return ts, int(seq), nil
+}
+
+// parseUnixTimestamp parses a length-10 dateint, optionally followed by nanoseconds.
+// This is "1500000000" or "1500000000.123456789". The former is also the legacy
+// format, which only had a resolution of one second.
+func parseUnixTimestamp(s string) (time.Time, error) {
+	secsStr, nanosStr, hasNanos := strings.Cut(s, ".")
+	if len(secsStr) != 10 || (hasNanos && len(nanosStr) != 9) {
+		return time.Time{}, errors.New("invalid timestamp")
+	}
+
+	secs, err := strconv.ParseUint(secsStr, 10, 63)
+	if err != nil {
+		return time.Time{}, errors.New("invalid timestamp")
+	}
+
+	nanos := uint64(0)
+	if hasNanos {
+		nanos, err = strconv.ParseUint(nanosStr, 10, 30)
+		if err != nil {
+			return time.Time{}, errors.New("invalid timestamp")
+		}
+	}
+
+	return time.Unix(int64(secs), int64(nanos)).UTC(), nil
+}
@@ -10,3 +10,10 @@ func reverseSliceReader(a []io.Reader) {
 		a[i], a[opp] = a[opp], a[i]
 	}
 }
+
+// readerFunc is an io.Reader implemented by a function
+type readerFunc func(p []byte) (int, error)
+
+func (me readerFunc) Read(p []byte) (int, error) {
+	return me(p)
+}